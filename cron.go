@@ -0,0 +1,231 @@
+package shezmu
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule defines activation times of a periodic job.
+type Schedule interface {
+	// Next returns the first activation time after the given time.
+	Next(t time.Time) time.Time
+}
+
+// cronSchedule is a schedule defined by a cron expression. Every field is a
+// bit set of allowed values.
+type cronSchedule struct {
+	expr   string
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	// Standard cron matches either day of month or day of week when both
+	// fields are restricted
+	domAny bool
+	dowAny bool
+	loc    *time.Location
+}
+
+type cronField struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	cronMinute = cronField{name: "minute", min: 0, max: 59}
+	cronHour   = cronField{name: "hour", min: 0, max: 23}
+	cronDom    = cronField{name: "day of month", min: 1, max: 31}
+	cronMonth  = cronField{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	cronDow = cronField{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+
+	cronDescriptors = map[string]string{
+		"@yearly":   "0 0 1 1 *",
+		"@annually": "0 0 1 1 *",
+		"@monthly":  "0 0 1 * *",
+		"@weekly":   "0 0 * * 0",
+		"@daily":    "0 0 * * *",
+		"@midnight": "0 0 * * *",
+		"@hourly":   "0 * * * *",
+	}
+)
+
+// ParseCron parses a standard cron expression that consists of five fields:
+// minute, hour, day of month, month and day of week. Fields support lists,
+// ranges, steps and three letter names of months and days of week.
+// Descriptors like @daily and @hourly are supported as well. Time zone could
+// be set with a CRON_TZ= or TZ= prefix, e.g. "CRON_TZ=UTC 0 3 * * *", local
+// time is used otherwise.
+func ParseCron(expr string) (Schedule, error) {
+	s := &cronSchedule{expr: expr, loc: time.Local}
+
+	spec := strings.TrimSpace(expr)
+	if strings.HasPrefix(spec, "CRON_TZ=") || strings.HasPrefix(spec, "TZ=") {
+		i := strings.IndexByte(spec, ' ')
+		if i < 0 {
+			return nil, fmt.Errorf("Invalid cron expression %q: missing fields", expr)
+		}
+		loc, err := time.LoadLocation(spec[strings.IndexByte(spec, '=')+1 : i])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid cron expression %q: %s", expr, err.Error())
+		}
+		s.loc = loc
+		spec = strings.TrimSpace(spec[i:])
+	}
+	if d, ok := cronDescriptors[spec]; ok {
+		spec = d
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("Invalid cron expression %q: expected 5 fields, got %d", expr, len(fields))
+	}
+
+	var err error
+	for i, f := range []struct {
+		bits *uint64
+		def  cronField
+	}{
+		{&s.minute, cronMinute},
+		{&s.hour, cronHour},
+		{&s.dom, cronDom},
+		{&s.month, cronMonth},
+		{&s.dow, cronDow},
+	} {
+		if *f.bits, err = parseCronField(fields[i], f.def); err != nil {
+			return nil, fmt.Errorf("Invalid cron expression %q: %s", expr, err.Error())
+		}
+	}
+	// Sunday could be either 0 or 7
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domAny = fields[2] == "*" || fields[2] == "?"
+	s.dowAny = fields[4] == "*" || fields[4] == "?"
+
+	return s, nil
+}
+
+func parseCronField(field string, def cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			var err error
+			rng = part[:i]
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid %s step %q", def.name, part[i+1:])
+			}
+		}
+
+		var lo, hi int
+		switch {
+		case rng == "*" || rng == "?":
+			lo, hi = def.min, def.max
+		case strings.IndexByte(rng, '-') > 0:
+			i := strings.IndexByte(rng, '-')
+			var err error
+			if lo, err = parseCronValue(rng[:i], def); err != nil {
+				return 0, err
+			}
+			if hi, err = parseCronValue(rng[i+1:], def); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid %s range %q", def.name, rng)
+			}
+		default:
+			var err error
+			if lo, err = parseCronValue(rng, def); err != nil {
+				return 0, err
+			}
+			hi = lo
+			// A single value with a step means "starting from"
+			if rng != part {
+				hi = def.max
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+func parseCronValue(val string, def cronField) (int, error) {
+	if n, ok := def.names[strings.ToLower(val)]; ok {
+		return n, nil
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil || n < def.min || n > def.max {
+		return 0, fmt.Errorf("invalid %s value %q", def.name, val)
+	}
+
+	return n, nil
+}
+
+// Next returns the first time after t that matches the schedule. Zero time is
+// returned if there is no such time within five years, e.g. for February 30.
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	orig := t.Location()
+	t = t.In(s.loc).Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.loc)
+			continue
+		}
+		if !s.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.loc)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, s.loc)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t.In(orig)
+	}
+
+	return time.Time{}
+}
+
+func (s *cronSchedule) matchDay(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+
+	return dom || dow
+}
+
+func (s *cronSchedule) String() string {
+	return s.expr
+}
+
+// everySchedule is a schedule with a fixed interval between activations.
+type everySchedule time.Duration
+
+func (s everySchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(s))
+}
+
+func (s everySchedule) String() string {
+	return "every " + time.Duration(s).String()
+}
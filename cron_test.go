@@ -0,0 +1,68 @@
+package shezmu
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	from := time.Date(2016, time.March, 15, 10, 30, 0, 0, time.UTC) // Tuesday
+	table := []struct {
+		expr string
+		exp  time.Time
+	}{
+		{"* * * * *", time.Date(2016, time.March, 15, 10, 31, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2016, time.March, 16, 3, 0, 0, 0, time.UTC)},
+		{"*/20 * * * *", time.Date(2016, time.March, 15, 10, 40, 0, 0, time.UTC)},
+		{"15,45 9-17 * * *", time.Date(2016, time.March, 15, 10, 45, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2016, time.April, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 * * sat", time.Date(2016, time.March, 19, 12, 0, 0, 0, time.UTC)},
+		{"0 12 * * 7", time.Date(2016, time.March, 20, 12, 0, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2020, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * mon", time.Date(2016, time.March, 21, 0, 0, 0, 0, time.UTC)},
+		{"5/15 * * * *", time.Date(2016, time.March, 15, 10, 35, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2016, time.March, 15, 11, 0, 0, 0, time.UTC)},
+	}
+
+	// Time zone is set explicitly to make tests independent of local time
+	for _, test := range table {
+		sched, err := ParseCron("TZ=UTC " + test.expr)
+		if err != nil {
+			t.Errorf("Failed to parse %q: %s", test.expr, err.Error())
+			continue
+		}
+		if next := sched.Next(from); !next.Equal(test.exp) {
+			t.Errorf("Expected next run of %q at %s, got %s", test.expr, test.exp, next)
+		}
+	}
+}
+
+func TestCronNever(t *testing.T) {
+	sched, err := ParseCron("0 0 30 feb *")
+	if err != nil {
+		t.Fatalf("Failed to parse expression: %s", err.Error())
+	}
+	if next := sched.Next(time.Now()); !next.IsZero() {
+		t.Errorf("Expected no next run, got %s", next)
+	}
+}
+
+func TestCronInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"* * * foo *",
+		"TZ=Nowhere/Land * * * * *",
+	} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("Expected %q to be invalid", expr)
+		}
+	}
+}
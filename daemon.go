@@ -1,11 +1,16 @@
 package shezmu
 
 import (
+	"container/list"
+	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/juju/ratelimit"
+	"github.com/localhots/shezmu/stats"
 )
 
 // Daemon is the interface that contains a set of methods required to be
@@ -45,44 +50,147 @@ type Daemon interface {
 
 // BaseDaemon is the parent structure for all daemons.
 type BaseDaemon struct {
-	self         Daemon
-	name         string
-	queue        chan<- *task
-	logger       Logger
-	panicHandler PanicHandler
-	shutdown     chan struct{}
-	limit        *ratelimit.Bucket
+	self           Daemon
+	name           string
+	shezmu         *Shezmu
+	queue          Queue
+	overflow       OverflowPolicy
+	priority       Priority
+	logger         Logger
+	panicHandler   PanicHandler
+	restart        *RestartPolicy
+	retry          *RetryPolicy
+	failureHandler FailureHandler
+	supervisor     *Supervisor
+	shutdown       chan struct{}
+	ctx            context.Context
+	cancel         context.CancelFunc
+	limit          *ratelimit.Bucket
+	timeout        time.Duration
+	pool           *pool
+	poolSize       int
+	poolQueueSize  int
+	jobs           []*Job
+	taskTypes      map[string]TaskHandler
+
+	concurrency struct {
+		sync.Mutex
+		limit   int
+		running int
+		held    list.List
+	}
+	// unique keeps unique tasks that were not started yet by their keys
+	unique struct {
+		sync.Mutex
+		tasks map[string]*uniqueTask
+	}
+	restarts    restartBudget
+	healthState daemonHealth
+	pauseState  pauseState
+	lifecycle   struct {
+		sync.Mutex
+		state   DaemonState
+		running bool
+		failed  bool
+		// started is closed when daemon Startup function finishes
+		started chan struct{}
+		// wg and tasks keep track of running system tasks
+		wg    sync.WaitGroup
+		tasks int
+	}
 }
 
+// ErrRateLimited is returned by TryProcess when the daemon exceeds its rate
+// limit.
+var ErrRateLimited = errors.New("daemon rate limit exceeded")
+
 // PanicHandler is a function that handles panics. Duh!
 type PanicHandler func(error)
 
-// Process creates a task and then adds it to processing queue.
-func (d *BaseDaemon) Process(a Actor) {
-	if d.limit != nil {
-		d.limit.Wait(1)
+// TaskOption is a function that modifies a task created by Process.
+type TaskOption func(*Task)
+
+// WithPriority overrides the daemon priority for a single task.
+func WithPriority(p Priority) TaskOption {
+	return func(t *Task) {
+		t.priority = p
 	}
+}
 
-	d.tryEnqueue(&task{
-		daemon:    d.self,
-		actor:     a,
-		createdAt: time.Now(),
-		name:      "Actor",
-	})
+// Process creates a task and then adds it to processing queue. Blocks while
+// the daemon is paused.
+func (d *BaseDaemon) Process(a Actor, opts ...TaskOption) {
+	d.ProcessContext(contextActor(a), opts...)
+}
+
+// ProcessContext is like Process but the actor receives the task context and
+// returns an error.
+func (d *BaseDaemon) ProcessContext(a ContextActor, opts ...TaskOption) {
+	d.waitResumed()
+	d.waitRate()
+	d.tryEnqueue(d.newTask(a, opts))
+}
+
+// TryProcess creates a task and then adds it to processing queue if there is
+// free space in it. Unlike Process it never blocks and returns ErrQueueFull if
+// the queue is full, ErrRateLimited if the daemon exceeds its rate limit or
+// ErrPaused if the daemon is paused.
+func (d *BaseDaemon) TryProcess(a Actor, opts ...TaskOption) error {
+	return d.TryProcessContext(contextActor(a), opts...)
+}
+
+// TryProcessContext is like TryProcess but the actor receives the task context
+// and returns an error.
+func (d *BaseDaemon) TryProcessContext(a ContextActor, opts ...TaskOption) error {
+	if d.IsPaused() {
+		return ErrPaused
+	}
+	if d.limit != nil && d.limit.TakeAvailable(1) == 0 {
+		return ErrRateLimited
+	}
+	t := d.newTask(a, opts)
+	q := d.queueFor(t)
+	if q == nil {
+		return ErrQueueClosed
+	}
+
+	_, err := q.Push(t, OverflowReject)
+	return err
+}
+
+// ProcessAfter creates a task that is added to processing queue after given
+// duration. Rate limit and overflow policy apply when the task is added to the
+// queue.
+func (d *BaseDaemon) ProcessAfter(dur time.Duration, a ContextActor, opts ...TaskOption) *DelayedTask {
+	return d.ProcessAt(time.Now().Add(dur), a, opts...)
+}
+
+// ProcessAt creates a task that is added to processing queue at given time.
+// See ProcessAfter for details.
+func (d *BaseDaemon) ProcessAt(at time.Time, a ContextActor, opts ...TaskOption) *DelayedTask {
+	return d.shezmu.timers.add(d.newTask(a, opts), at)
 }
 
 // SystemProcess creates a system task that is restarted in case of failure
 // and then adds it to processing queue.
 func (d *BaseDaemon) SystemProcess(name string, a Actor) {
+	d.SystemProcessContext(name, contextActor(a))
+}
+
+// SystemProcessContext is like SystemProcess but the actor receives the task
+// context and returns an error. A system task that returns an error is
+// restarted unless its context was cancelled.
+func (d *BaseDaemon) SystemProcessContext(name string, a ContextActor) {
 	if name == "" {
 		name = "SystemProcess"
 	}
 
-	d.tryEnqueue(&task{
+	d.tryEnqueue(&Task{
 		daemon:    d.self,
 		actor:     a,
 		createdAt: time.Now(),
 		system:    true,
+		priority:  PriorityCritical,
 		name:      name,
 	})
 }
@@ -91,26 +199,123 @@ func (d *BaseDaemon) SystemProcess(name string, a Actor) {
 func (d *BaseDaemon) LimitRate(times int, per time.Duration) {
 	rate := float64(time.Second) / float64(per) * float64(times)
 	if rate <= 0 {
-		d.Logf("Daemon %s processing rate was limited to %d. Using 1 instead", d.base(), rate)
+		d.log(LevelWarn, "Invalid processing rate limit, using 1 instead", F("rate", rate))
 		rate = 1.0
 	}
-	d.Logf("Daemon %s processing rate is limited to %.2f ops/s", d.base(), rate)
+	d.log(LevelInfo, "Processing rate is limited", F("rate", rate))
 	d.limit = ratelimit.NewBucketWithRate(rate, 1)
 }
 
+// LimitConcurrency limits the number of daemon tasks that are processed at the
+// same time. Tasks over the limit are held without occupying a worker. System
+// tasks are not affected.
+func (d *BaseDaemon) LimitConcurrency(n int) {
+	if n <= 0 {
+		d.log(LevelWarn, "Invalid concurrency limit, using 1 instead", F("concurrency", n))
+		n = 1
+	}
+	d.log(LevelInfo, "Concurrency is limited", F("concurrency", n))
+
+	d.concurrency.Lock()
+	d.concurrency.limit = n
+	d.concurrency.Unlock()
+}
+
+// UsePool makes the daemon process its tasks with a dedicated pool of workers
+// that has its own task queue, isolating it from other daemons. System tasks
+// are still processed by the main pool. If the daemon is running without a
+// dedicated pool, e.g. when called from Startup, the pool is started right
+// away and tasks queued from then on are processed by it. Otherwise changes
+// take effect the next time the daemon starts.
+func (d *BaseDaemon) UsePool(workers, queueSize int) {
+	if workers <= 0 {
+		d.log(LevelWarn, "Invalid dedicated pool size, using 1 instead", F("workers", workers))
+		workers = 1
+	}
+
+	var p *pool
+	d.lifecycle.Lock()
+	d.poolSize = workers
+	d.poolQueueSize = queueSize
+	if d.lifecycle.running && d.pool == nil {
+		p = newPool(d.shezmu.NewQueue(queueSize))
+		d.pool = p
+	}
+	d.lifecycle.Unlock()
+
+	if p != nil {
+		d.log(LevelInfo, "Starting dedicated workers", F("workers", workers))
+		d.shezmu.startWorkers(p, workers)
+	}
+}
+
+// LimitDuration sets a deadline for every task processed by the daemon. The
+// deadline is carried by the context passed to a ContextActor. Tasks that run
+// past the deadline are reported by the watchdog. System tasks are not
+// affected.
+func (d *BaseDaemon) LimitDuration(dur time.Duration) {
+	d.timeout = dur
+}
+
+// SetPriority sets the priority of the daemon tasks. Default priority is
+// PriorityNormal. System tasks always have PriorityCritical.
+func (d *BaseDaemon) SetPriority(p Priority) {
+	d.priority = p
+}
+
+// HandleOverflow sets up a policy that is applied when the daemon adds a task
+// to a full queue. Dropped tasks are reported to Shezmu.DaemonStats.
+func (d *BaseDaemon) HandleOverflow(p OverflowPolicy) {
+	d.overflow = p
+}
+
 // HandlePanics sets up a panic handler function for the daemon.
 func (d *BaseDaemon) HandlePanics(f PanicHandler) {
 	d.panicHandler = f
 }
 
+// SetRestartPolicy overrides Shezmu.RestartPolicy for the daemon system tasks.
+func (d *BaseDaemon) SetRestartPolicy(p RestartPolicy) {
+	d.restart = &p
+}
+
+// HandleFailure sets up a function that is called when the daemon exhausts
+// its restart budget and is marked as failed.
+func (d *BaseDaemon) HandleFailure(f FailureHandler) {
+	d.failureHandler = f
+}
+
+// Failed returns true if the daemon exhausted its restart budget.
+func (d *BaseDaemon) Failed() bool {
+	d.lifecycle.Lock()
+	defer d.lifecycle.Unlock()
+
+	return d.lifecycle.failed
+}
+
 // ShutdownRequested returns a channel that is closed the moment daemon shutdown
 // is requested.
 func (d *BaseDaemon) ShutdownRequested() <-chan struct{} {
 	return d.shutdown
 }
 
+// Context returns a context that is cancelled the moment daemon shutdown is
+// requested.
+func (d *BaseDaemon) Context() context.Context {
+	if d.ctx == nil {
+		return context.Background()
+	}
+
+	return d.ctx
+}
+
 // Continue returns true if daemon should proceed and false if it should stop.
+// Blocks while the daemon is paused.
 func (d *BaseDaemon) Continue() bool {
+	if !d.waitResumed() {
+		return false
+	}
+
 	select {
 	case <-d.shutdown:
 		return false
@@ -119,18 +324,22 @@ func (d *BaseDaemon) Continue() bool {
 	}
 }
 
-// Log logs values using shezmu.Logger.Println function.
+// Log logs values formatted with fmt.Sprint at info level using shezmu.Logger.
+// The daemon name is attached as a field.
 func (d *BaseDaemon) Log(v ...interface{}) {
-	if d.logger != nil {
-		d.logger.Println(append([]interface{}{"[" + d.String() + "]"}, v...)...)
-	}
+	d.log(LevelInfo, fmt.Sprint(v...))
 }
 
-// Logf logs values using shezmu.Logger.Printf function.
+// Logf logs values formatted with fmt.Sprintf at info level using
+// shezmu.Logger. The daemon name is attached as a field.
 func (d *BaseDaemon) Logf(format string, v ...interface{}) {
-	if d.logger != nil {
-		d.logger.Printf("["+d.String()+"] "+format, v...)
-	}
+	d.log(LevelInfo, fmt.Sprintf(format, v...))
+}
+
+// Logger returns a logger that attaches the daemon name as a field to every
+// message.
+func (d *BaseDaemon) Logger() Logger {
+	return daemonLogger{d}
 }
 
 // Startup is the empty implementation of the daemons' Startup function that
@@ -156,14 +365,282 @@ func (d *BaseDaemon) base() *BaseDaemon {
 	return d
 }
 
-func (d *BaseDaemon) tryEnqueue(t *task) {
-	defer func() {
-		if err := recover(); err != nil {
-			d.Logf("Failed to enqueue task %q due to process termination", t)
+func (d *BaseDaemon) newTask(a ContextActor, opts []TaskOption) *Task {
+	t := &Task{
+		daemon:    d.self,
+		actor:     a,
+		createdAt: time.Now(),
+		priority:  d.priority,
+		name:      "Actor",
+		retry:     d.retry,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return t
+}
+
+// queueFor returns the queue a task should be added to.
+func (d *BaseDaemon) queueFor(t *Task) Queue {
+	d.lifecycle.Lock()
+	defer d.lifecycle.Unlock()
+
+	if d.queue == nil {
+		return nil
+	}
+	if d.pool != nil && !t.system {
+		return d.pool.queue
+	}
+
+	return d.queue
+}
+
+// dedicatedPool returns the dedicated pool of the daemon along with the number
+// of its workers, the pool is nil if the daemon uses the main pool.
+func (d *BaseDaemon) dedicatedPool() (*pool, int) {
+	d.lifecycle.Lock()
+	defer d.lifecycle.Unlock()
+
+	return d.pool, d.poolSize
+}
+
+func (d *BaseDaemon) tryEnqueue(t *Task) {
+	d.enqueue(t)
+}
+
+// enqueue adds a task to the queue. Tasks that could not be added are
+// completed with an error, which is also returned.
+func (d *BaseDaemon) enqueue(t *Task) error {
+	q := d.queueFor(t)
+	if q == nil {
+		d.log(LevelWarn, "Failed to enqueue task because daemons are not running", F("task", t.name))
+		t.complete(ErrNotRunning, nil)
+		return ErrNotRunning
+	}
+
+	dropped, err := q.Push(t, d.overflow)
+	if err == ErrQueueFull {
+		d.log(LevelWarn, "Failed to enqueue task because the queue is full", F("task", t.name))
+		stats.Drop(d.shezmu.DaemonStats, t.daemon.String())
+		t.complete(err, nil)
+		return err
+	}
+	if err != nil {
+		d.log(LevelWarn, "Failed to enqueue task due to process termination", F("task", t.name), F("error", err))
+		t.complete(err, nil)
+		return err
+	}
+	if dropped != nil {
+		stats.Drop(d.shezmu.DaemonStats, dropped.daemon.String())
+		dropped.complete(ErrQueueFull, nil)
+		if dropped == t {
+			return ErrQueueFull
 		}
-	}()
+	}
+
+	return nil
+}
+
+// enqueueDelayed adds a delayed task to the queue once it is due.
+func (d *BaseDaemon) enqueueDelayed(t *Task) {
+	d.waitRate()
+	t.createdAt = time.Now()
+	d.tryEnqueue(t)
+}
+
+func (d *BaseDaemon) taskContext() (context.Context, context.CancelFunc) {
+	if d.timeout > 0 {
+		return context.WithTimeout(d.Context(), d.timeout)
+	}
+
+	return context.WithCancel(d.Context())
+}
+
+// start attaches the daemon to a task queue and creates a new shutdown channel
+// and context. It returns false if the daemon is already running.
+func (d *BaseDaemon) start(q Queue) bool {
+	l := &d.lifecycle
+	l.Lock()
+	if l.running {
+		l.Unlock()
+		return false
+	}
+	l.running = true
+	l.failed = false
+	l.started = make(chan struct{})
+	d.queue = q
+	d.pool = nil
+	if d.poolSize > 0 {
+		d.pool = newPool(d.shezmu.NewQueue(d.poolQueueSize))
+	}
+	d.shutdown = make(chan struct{})
+	d.ctx, d.cancel = context.WithCancel(context.Background())
+	d.restarts.reset()
+	d.resetHealth()
+	e, ok := d.transition(StateStarting, nil)
+	l.Unlock()
+
+	if ok {
+		d.emit(e)
+	}
+	return true
+}
+
+// stop closes the shutdown channel and cancels the context of the daemon. It
+// returns false if the daemon is not running.
+func (d *BaseDaemon) stop() bool {
+	l := &d.lifecycle
+	l.Lock()
+	if !l.running {
+		l.Unlock()
+		return false
+	}
+	l.running = false
+	close(d.shutdown)
+	d.cancel()
+	e, ok := d.transition(StateStopping, nil)
+	l.Unlock()
+
+	if ok {
+		d.emit(e)
+	}
+	return true
+}
+
+// detach detaches the daemon from its task queues. Tasks that are added after
+// that fail with ErrNotRunning.
+func (d *BaseDaemon) detach() {
+	d.lifecycle.Lock()
+	defer d.lifecycle.Unlock()
+
+	d.queue = nil
+}
+
+// markStarted signals that daemon Startup function has finished.
+func (d *BaseDaemon) markStarted() {
+	l := &d.lifecycle
+	l.Lock()
+	select {
+	case <-l.started:
+	default:
+		close(l.started)
+	}
+	e, ok := d.transition(StateRunning, nil)
+	l.Unlock()
+
+	if ok {
+		d.emit(e)
+	}
+}
+
+// startedChan returns a channel that is closed when daemon Startup function
+// finishes. It returns false if the daemon is not running.
+func (d *BaseDaemon) startedChan() (<-chan struct{}, bool) {
+	l := &d.lifecycle
+	l.Lock()
+	defer l.Unlock()
+
+	return l.started, l.running
+}
+
+// enterSystemTask registers a running system task. It returns false if the
+// daemon is not running.
+func (d *BaseDaemon) enterSystemTask() bool {
+	l := &d.lifecycle
+	l.Lock()
+	defer l.Unlock()
+
+	if !l.running {
+		return false
+	}
+	l.wg.Add(1)
+	l.tasks++
+
+	return true
+}
+
+func (d *BaseDaemon) exitSystemTask() {
+	l := &d.lifecycle
+	l.Lock()
+	l.tasks--
+	l.Unlock()
+	l.wg.Done()
+}
+
+// isRunning returns true if the daemon was started and not yet stopped.
+func (d *BaseDaemon) isRunning() bool {
+	d.lifecycle.Lock()
+	defer d.lifecycle.Unlock()
+
+	return d.lifecycle.running
+}
+
+// systemTasks returns the number of running system tasks.
+func (d *BaseDaemon) systemTasks() int {
+	d.lifecycle.Lock()
+	defer d.lifecycle.Unlock()
+
+	return d.lifecycle.tasks
+}
+
+// acquire takes a concurrency slot for the task. If there are no free slots
+// or the daemon is paused the task is held and false is returned.
+func (d *BaseDaemon) acquire(t *Task) bool {
+	c := &d.concurrency
+	c.Lock()
+	defer c.Unlock()
+
+	if !d.IsPaused() && (c.limit == 0 || c.running < c.limit) {
+		c.running++
+		return true
+	}
+
+	c.held.PushBack(t)
+	if t.queue != nil {
+		t.queue.hold(1)
+	}
+
+	return false
+}
+
+// release frees a concurrency slot. If there are held tasks the slot is passed
+// to the next one, which is then returned, unless the daemon is paused.
+func (d *BaseDaemon) release() *Task {
+	c := &d.concurrency
+	c.Lock()
+	defer c.Unlock()
+
+	if c.held.Len() > 0 && !d.IsPaused() {
+		t := c.held.Remove(c.held.Front()).(*Task)
+		if t.queue != nil {
+			t.queue.hold(-1)
+		}
+
+		return t
+	}
+
+	c.running--
+	return nil
+}
+
+// abandonHeld removes all tasks that are waiting for a concurrency slot and
+// returns them.
+func (d *BaseDaemon) abandonHeld() []*Task {
+	c := &d.concurrency
+	c.Lock()
+	defer c.Unlock()
+
+	var tasks []*Task
+	for c.held.Len() > 0 {
+		t := c.held.Remove(c.held.Front()).(*Task)
+		if t.queue != nil {
+			t.queue.hold(-1)
+		}
+		tasks = append(tasks, t)
+	}
 
-	d.queue <- t
+	return tasks
 }
 
 func (d *BaseDaemon) handlePanic(err error) {
@@ -0,0 +1,122 @@
+package shezmu
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLimitConcurrency(t *testing.T) {
+	limited := &testDaemon{BaseDaemon{name: "limited"}}
+	limited.LimitConcurrency(1)
+	other := &testDaemon{BaseDaemon{name: "other"}}
+	s := newTestShezmu(limited, other)
+	s.StartDaemons()
+	defer s.StopDaemons()
+
+	var mu sync.Mutex
+	var running, maxRunning int
+	started := make(chan struct{}, 4)
+	block := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		limited.Process(func() {
+			defer wg.Done()
+			mu.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mu.Unlock()
+			started <- struct{}{}
+
+			<-block
+			mu.Lock()
+			running--
+			mu.Unlock()
+		})
+	}
+	<-started
+	for s.mainPool().queue.Len() > 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Held tasks of the limited daemon leave the second worker free
+	done := make(chan error)
+	go func() {
+		done <- other.ProcessWait(func(context.Context) error { return nil })
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected task of other daemon to be processed, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected held tasks not to occupy workers")
+	}
+
+	close(block)
+	wg.Wait()
+	if maxRunning != 1 {
+		t.Errorf("Expected at most 1 task to run at the same time, got %d", maxRunning)
+	}
+}
+
+type poolDaemon struct {
+	BaseDaemon
+}
+
+func (d *poolDaemon) Startup() {
+	d.UsePool(1, 10)
+}
+
+func TestUsePool(t *testing.T) {
+	isolated := &testDaemon{BaseDaemon{name: "isolated"}}
+	isolated.UsePool(1, 10)
+	other := &testDaemon{BaseDaemon{name: "other"}}
+	testIsolated(t, isolated, other)
+}
+
+func TestUsePoolFromStartup(t *testing.T) {
+	isolated := &poolDaemon{BaseDaemon{name: "isolated"}}
+	other := &testDaemon{BaseDaemon{name: "other"}}
+	testIsolated(t, isolated, other)
+}
+
+// testIsolated checks that tasks of the isolated daemon are not blocked by the
+// other daemon and vice versa.
+func testIsolated(t *testing.T, isolated, other Daemon) {
+	s := newTestShezmu(isolated, other)
+	s.NumWorkers = 1
+	s.StartDaemons()
+	defer s.StopDaemons()
+	waitStarted(isolated, other)
+
+	// Each daemon occupies its pool in turn, the other one is not affected
+	for _, pair := range [][2]*BaseDaemon{{other.base(), isolated.base()}, {isolated.base(), other.base()}} {
+		busy, free := pair[0], pair[1]
+		block := make(chan struct{})
+		running := make(chan struct{})
+		busy.Process(func() {
+			close(running)
+			<-block
+		})
+		<-running
+
+		done := make(chan error)
+		go func() {
+			done <- free.ProcessWait(func(context.Context) error { return nil })
+		}()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("Expected task of %s to be processed, got %v", free, err)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("Expected %s not to be blocked by %s", free, busy)
+		}
+		close(block)
+	}
+}
@@ -0,0 +1,169 @@
+package shezmu
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// DeadLetter describes a task that failed permanently, either because it
+// panicked or its retries were exhausted.
+type DeadLetter struct {
+	Daemon   string    `json:"daemon"`
+	Task     string    `json:"task"`
+	Error    string    `json:"error"`
+	Stack    string    `json:"stack,omitempty"`
+	Attempts int       `json:"attempts"`
+	Time     time.Time `json:"time"`
+	// Payload is the value attached to the task with WithPayload. It should
+	// be serializable to be written to a file.
+	Payload interface{} `json:"payload,omitempty"`
+}
+
+// DeadLetterSink is the interface that receives permanently failed tasks.
+type DeadLetterSink interface {
+	Put(l DeadLetter) error
+}
+
+// WithPayload attaches a value to a task that is passed to the dead letter
+// sink if the task fails permanently. The value should contain everything
+// needed to replay the task.
+func WithPayload(p interface{}) TaskOption {
+	return func(t *Task) {
+		t.payload = p
+	}
+}
+
+// deadLetter passes a permanently failed task to the dead letter sink.
+func (s *Shezmu) deadLetter(t *Task, err error, stack []byte) {
+	if s.DeadLetters == nil {
+		return
+	}
+
+	l := DeadLetter{
+		Daemon:   t.daemon.String(),
+		Task:     t.name,
+		Error:    err.Error(),
+		Stack:    string(stack),
+		Attempts: t.attempt + 1,
+		Time:     time.Now(),
+		Payload:  t.payload,
+	}
+	if err := s.DeadLetters.Put(l); err != nil {
+		s.Logger.Log(LevelError, "Failed to save dead letter", t.fields(F("error", err))...)
+	}
+}
+
+//
+// Memory
+//
+
+// MemoryDeadLetterSink keeps dead letters in memory.
+type MemoryDeadLetterSink struct {
+	mu      sync.Mutex
+	limit   int
+	letters []DeadLetter
+}
+
+// NewMemoryDeadLetterSink creates a new in-memory dead letter sink that keeps
+// up to limit most recent letters. Zero or negative limit makes it unbounded.
+func NewMemoryDeadLetterSink(limit int) *MemoryDeadLetterSink {
+	return &MemoryDeadLetterSink{limit: limit}
+}
+
+// Put adds a letter to the sink, the oldest letter is removed if the sink is
+// full.
+func (m *MemoryDeadLetterSink) Put(l DeadLetter) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.limit > 0 && len(m.letters) >= m.limit {
+		m.letters = append(m.letters[:0], m.letters[1:]...)
+	}
+	m.letters = append(m.letters, l)
+
+	return nil
+}
+
+// Letters returns a copy of stored letters, oldest first.
+func (m *MemoryDeadLetterSink) Letters() []DeadLetter {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]DeadLetter(nil), m.letters...)
+}
+
+// Take removes and returns all stored letters, oldest first.
+func (m *MemoryDeadLetterSink) Take() []DeadLetter {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	letters := m.letters
+	m.letters = nil
+
+	return letters
+}
+
+//
+// File
+//
+
+// FileDeadLetterSink appends dead letters to a file, one JSON object per line.
+type FileDeadLetterSink struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// NewFileDeadLetterSink opens a file for appending dead letters, the file is
+// created if it does not exist.
+func NewFileDeadLetterSink(path string) (*FileDeadLetterSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileDeadLetterSink{file: f, enc: json.NewEncoder(f)}, nil
+}
+
+// Put writes a letter to the file.
+func (f *FileDeadLetterSink) Put(l DeadLetter) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.enc.Encode(l)
+}
+
+// Close closes the file.
+func (f *FileDeadLetterSink) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.file.Close()
+}
+
+// ReadDeadLetters reads dead letters written by FileDeadLetterSink. Payloads
+// are decoded as generic JSON values.
+func ReadDeadLetters(path string) ([]DeadLetter, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var letters []DeadLetter
+	scanner := bufio.NewScanner(f)
+	// Stack traces could make lines longer than default token size
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var l DeadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &l); err != nil {
+			return letters, err
+		}
+		letters = append(letters, l)
+	}
+
+	return letters, scanner.Err()
+}
@@ -0,0 +1,86 @@
+package shezmu
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMemoryDeadLetterSink(t *testing.T) {
+	m := NewMemoryDeadLetterSink(2)
+	for _, name := range []string{"a", "b", "c"} {
+		m.Put(DeadLetter{Task: name})
+	}
+
+	letters := m.Letters()
+	if len(letters) != 2 || letters[0].Task != "b" || letters[1].Task != "c" {
+		t.Errorf("Expected two most recent letters, got %v", letters)
+	}
+	if letters = m.Take(); len(letters) != 2 {
+		t.Errorf("Expected to take two letters, got %d", len(letters))
+	}
+	if letters = m.Letters(); len(letters) != 0 {
+		t.Errorf("Expected sink to be empty, got %d letters", len(letters))
+	}
+}
+
+func TestFileDeadLetterSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shezmu")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "dead.jsonl")
+	f, err := NewFileDeadLetterSink(path)
+	if err != nil {
+		t.Fatalf("Failed to create sink: %s", err.Error())
+	}
+	f.Put(DeadLetter{Daemon: "Webhooks", Task: "Actor", Error: "timeout", Attempts: 3, Payload: "http://example.com"})
+	f.Put(DeadLetter{Daemon: "Webhooks", Task: "Actor", Error: "panic", Stack: "goroutine 1"})
+	f.Close()
+
+	letters, err := ReadDeadLetters(path)
+	if err != nil {
+		t.Fatalf("Failed to read letters: %s", err.Error())
+	}
+	if len(letters) != 2 {
+		t.Fatalf("Expected 2 letters, got %d", len(letters))
+	}
+	if l := letters[0]; l.Attempts != 3 || l.Payload != "http://example.com" || l.Error != "timeout" {
+		t.Errorf("Unexpected first letter: %+v", l)
+	}
+	if l := letters[1]; l.Stack != "goroutine 1" {
+		t.Errorf("Unexpected second letter: %+v", l)
+	}
+}
+
+func TestDeadLetterPendingRetry(t *testing.T) {
+	d := &testDaemon{BaseDaemon{name: "test"}}
+	s := newTestShezmu(d)
+	sink := NewMemoryDeadLetterSink(0)
+	s.DeadLetters = sink
+	s.StartDaemons()
+
+	errTask := errors.New("task failed")
+	f := d.Submit(func() (interface{}, error) { return nil, errTask },
+		WithRetry(RetryPolicy{MaxAttempts: 3, InitialDelay: time.Hour}), WithPayload("payload"))
+	for s.timers.len() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	s.StopDaemons()
+
+	if _, err := f.Wait(); err != errTask {
+		t.Errorf("Expected future to be resolved with the last error, got %v", err)
+	}
+	letters := sink.Letters()
+	if len(letters) != 1 {
+		t.Fatalf("Expected dropped retry to be sent to dead letters, got %d letters", len(letters))
+	}
+	if l := letters[0]; l.Error != errTask.Error() || l.Attempts != 1 || l.Payload != "payload" {
+		t.Errorf("Unexpected dead letter: %+v", l)
+	}
+}
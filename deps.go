@@ -0,0 +1,115 @@
+package shezmu
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Dependent is the interface that could be implemented by daemons that depend
+// on other daemons. Daemon is started after Startup functions of all of its
+// dependencies finish and is shut down before any of them.
+type Dependent interface {
+	// DependsOn returns the names of daemons this daemon depends on.
+	DependsOn() []string
+}
+
+// dependencies returns the names of daemons given daemon depends on.
+func dependencies(d Daemon) []string {
+	if dep, ok := d.(Dependent); ok {
+		return dep.DependsOn()
+	}
+
+	return nil
+}
+
+// checkDependencies returns an error if adding a daemon to the list would
+// create a dependency cycle.
+func checkDependencies(daemons []Daemon, d Daemon) error {
+	byName := map[string]Daemon{d.String(): d}
+	for _, rd := range daemons {
+		byName[rd.String()] = rd
+	}
+
+	var visit func(cur Daemon, path []string) error
+	visit = func(cur Daemon, path []string) error {
+		for _, name := range dependencies(cur) {
+			if name == d.String() {
+				return fmt.Errorf("Daemon dependency cycle: %s",
+					strings.Join(append(path, name), " -> "))
+			}
+			if dep, ok := byName[name]; ok {
+				if err := visit(dep, append(path, name)); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	}
+
+	return visit(d, []string{d.String()})
+}
+
+// sortDaemons returns daemons sorted in such order that every daemon comes
+// after its dependencies. Otherwise the original order is preserved.
+func sortDaemons(daemons []Daemon) []Daemon {
+	byName := make(map[string]Daemon, len(daemons))
+	for _, d := range daemons {
+		byName[d.String()] = d
+	}
+
+	sorted := make([]Daemon, 0, len(daemons))
+	visited := make(map[Daemon]bool, len(daemons))
+	var visit func(d Daemon)
+	visit = func(d Daemon) {
+		if visited[d] {
+			return
+		}
+		visited[d] = true
+		for _, name := range dependencies(d) {
+			if dep, ok := byName[name]; ok {
+				visit(dep)
+			}
+		}
+		sorted = append(sorted, d)
+	}
+	for _, d := range daemons {
+		visit(d)
+	}
+
+	return sorted
+}
+
+// stopInOrder stops sorted daemons one by one in reverse order, so that every
+// daemon is stopped before its dependencies.
+func (s *Shezmu) stopInOrder(sorted []Daemon) {
+	for i := len(sorted) - 1; i >= 0; i-- {
+		s.stopDaemons(sorted[i : i+1])
+	}
+}
+
+// waitForDependencies blocks until all running dependencies of a daemon finish
+// their startup. It returns false if the daemon was stopped while waiting.
+func (s *Shezmu) waitForDependencies(d Daemon) bool {
+	base := d.base()
+	for _, name := range dependencies(d) {
+		dep, err := s.lookup(name)
+		if err != nil {
+			base.log(LevelWarn, "Dependency is not registered", F("dependency", name))
+			continue
+		}
+
+		started, ok := dep.base().startedChan()
+		if !ok {
+			base.log(LevelWarn, "Dependency is not running", F("dependency", dep.String()))
+			continue
+		}
+		select {
+		case <-started:
+		case <-base.shutdown:
+			return false
+		}
+	}
+
+	return true
+}
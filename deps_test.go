@@ -0,0 +1,52 @@
+package shezmu
+
+import (
+	"testing"
+)
+
+type depDaemon struct {
+	BaseDaemon
+	deps []string
+}
+
+func (d *depDaemon) DependsOn() []string {
+	return d.deps
+}
+
+func newDepDaemon(name string, deps ...string) *depDaemon {
+	d := &depDaemon{deps: deps}
+	d.self = d
+	d.name = name
+
+	return d
+}
+
+func TestSortDaemons(t *testing.T) {
+	a := newDepDaemon("A", "C")
+	b := newDepDaemon("B")
+	c := newDepDaemon("C", "B")
+
+	sorted := sortDaemons([]Daemon{a, b, c})
+	for i, exp := range []string{"B", "C", "A"} {
+		if name := sorted[i].String(); name != exp {
+			t.Errorf("Expected daemon #%d to be %s, got %s", i, exp, name)
+		}
+	}
+}
+
+func TestCheckDependencies(t *testing.T) {
+	a := newDepDaemon("A", "B")
+	b := newDepDaemon("B", "C")
+	c := newDepDaemon("C", "A")
+
+	if err := checkDependencies([]Daemon{a}, b); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	err := checkDependencies([]Daemon{a, b}, c)
+	if err == nil {
+		t.Fatal("Expected dependency cycle to be detected")
+	}
+	if exp := "Daemon dependency cycle: C -> A -> B -> C"; err.Error() != exp {
+		t.Errorf("Expected error %q, got %q", exp, err.Error())
+	}
+}
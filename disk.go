@@ -0,0 +1,335 @@
+package shezmu
+
+import (
+	"bufio"
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// diskQueue is a FIFO queue that keeps up to memory tasks in memory and spills
+// the rest of durable tasks to a file. Tasks carry closures, so only tasks
+// created with ProcessDurable could be written to disk, they are restored from
+// their type and payload when taken from the queue. Other tasks are always
+// kept in memory and could overtake spilled tasks.
+type diskQueue struct {
+	sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	mem      *list.List
+	memory   int
+	capacity int
+	held     int
+	draining bool
+	closed   bool
+
+	path    string
+	w       *os.File
+	r       *os.File
+	reader  *bufio.Reader
+	spilled int
+	daemons map[string]Daemon
+}
+
+// diskRecord is a durable task written to the queue file.
+type diskRecord struct {
+	Daemon   string          `json:"daemon"`
+	Type     string          `json:"type"`
+	Payload  json.RawMessage `json:"payload"`
+	ID       uint64          `json:"id"`
+	Priority Priority        `json:"priority"`
+	Created  time.Time       `json:"created"`
+}
+
+// NewDiskQueue returns a factory of FIFO queues that keep up to memory tasks
+// in memory and write the rest of durable tasks to files in given directory,
+// one file per queue. Only tasks created with ProcessDurable that have no
+// task-specific retry policy are written to disk, other tasks are kept in
+// memory regardless of the limit and could overtake tasks written to disk.
+// Files are removed once the queue is empty. Tasks that failed to be written
+// or read stay in the write-ahead log and are replayed on the next start.
+func NewDiskQueue(dir string, memory int) QueueFactory {
+	var n int64
+	return func(capacity int) Queue {
+		name := fmt.Sprintf("queue-%d-%d.jsonl", os.Getpid(), atomic.AddInt64(&n, 1))
+		return newDiskQueue(filepath.Join(dir, name), capacity, memory)
+	}
+}
+
+func newDiskQueue(path string, capacity, memory int) *diskQueue {
+	q := &diskQueue{
+		mem:      list.New(),
+		memory:   memory,
+		capacity: capacity,
+		path:     path,
+		daemons:  make(map[string]Daemon),
+	}
+	q.notEmpty = sync.NewCond(q)
+	q.notFull = sync.NewCond(q)
+
+	return q
+}
+
+// Push adds a task to the queue applying given overflow policy.
+func (q *diskQueue) Push(t *Task, p OverflowPolicy) (dropped *Task, err error) {
+	q.Lock()
+	defer q.Unlock()
+
+	// Exactly one task is dropped to make space for a new one, even if system
+	// tasks keep the queue over capacity
+	for dropped == nil && !q.closed && !q.draining && !t.system && q.full() {
+		switch p {
+		case OverflowBlock:
+			q.notFull.Wait()
+			continue
+		case OverflowDropNewest:
+			return t, nil
+		case OverflowDropOldest:
+			// Only tasks kept in memory could be dropped
+			if dropped = q.removeOldest(t.daemon); dropped == nil {
+				return t, nil
+			}
+		default:
+			return nil, ErrQueueFull
+		}
+	}
+	if q.closed || q.draining {
+		return nil, ErrQueueClosed
+	}
+
+	// Once tasks are spilled, following durable tasks are spilled too to keep
+	// their order
+	if (q.mem.Len() >= q.memory || q.spilled > 0) && spillable(t) && q.spill(t) == nil {
+		q.notEmpty.Signal()
+		return dropped, nil
+	}
+	t.queue = q
+	q.mem.PushBack(t)
+	q.notEmpty.Signal()
+
+	return dropped, nil
+}
+
+// Pop takes the next task from the queue waiting for one if necessary.
+func (q *diskQueue) Pop() (*Task, bool) {
+	q.Lock()
+	defer q.Unlock()
+
+	for {
+		for !q.closed && !q.draining && q.len() == 0 {
+			q.notEmpty.Wait()
+		}
+		if q.closed || q.len() == 0 {
+			q.removeFile()
+			return nil, false
+		}
+
+		if e := q.mem.Front(); e != nil {
+			q.mem.Remove(e)
+			q.notFull.Signal()
+			return e.Value.(*Task), true
+		}
+		t := q.restore()
+		q.notFull.Signal()
+		if t != nil {
+			return t, true
+		}
+	}
+}
+
+// Len returns the number of queued tasks.
+func (q *diskQueue) Len() int {
+	q.Lock()
+	defer q.Unlock()
+
+	return q.len()
+}
+
+// Close makes all pending and future push calls fail while pop calls continue
+// to return queued tasks until the queue is empty.
+func (q *diskQueue) Close() {
+	q.Lock()
+	defer q.Unlock()
+
+	q.draining = true
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+}
+
+func (q *diskQueue) hold(n int) {
+	q.Lock()
+	defer q.Unlock()
+
+	q.held += n
+	if n < 0 {
+		q.notFull.Signal()
+	}
+}
+
+// wait returns for how long the oldest task kept in memory has been waiting.
+func (q *diskQueue) wait() time.Duration {
+	q.Lock()
+	defer q.Unlock()
+
+	if e := q.mem.Front(); e != nil {
+		return time.Now().Sub(e.Value.(*Task).createdAt)
+	}
+
+	return 0
+}
+
+func (q *diskQueue) abandon() []*Task {
+	q.Lock()
+	defer q.Unlock()
+
+	tasks := make([]*Task, 0, q.len())
+	for e := q.mem.Front(); e != nil; e = e.Next() {
+		tasks = append(tasks, e.Value.(*Task))
+	}
+	q.mem.Init()
+	for q.spilled > 0 {
+		if t := q.restore(); t != nil {
+			tasks = append(tasks, t)
+		}
+	}
+	q.removeFile()
+	q.closed = true
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+
+	return tasks
+}
+
+func (q *diskQueue) len() int {
+	return q.mem.Len() + q.spilled
+}
+
+func (q *diskQueue) full() bool {
+	return q.capacity > 0 && q.len()+q.held >= q.capacity
+}
+
+// removeOldest removes the oldest general task of the given daemon that is
+// kept in memory.
+func (q *diskQueue) removeOldest(d Daemon) *Task {
+	for e := q.mem.Front(); e != nil; e = e.Next() {
+		if t := e.Value.(*Task); t.daemon == d && !t.system {
+			q.mem.Remove(e)
+			return t
+		}
+	}
+
+	return nil
+}
+
+// spill writes a task to the queue file, creating it if necessary.
+func (q *diskQueue) spill(t *Task) error {
+	if q.w == nil {
+		w, err := os.OpenFile(q.path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return err
+		}
+		r, err := os.Open(q.path)
+		if err != nil {
+			w.Close()
+			return err
+		}
+		q.w, q.r, q.reader = w, r, bufio.NewReader(r)
+	}
+
+	line, err := json.Marshal(diskRecord{
+		Daemon:   t.daemon.String(),
+		Type:     t.name,
+		Payload:  t.payload.(json.RawMessage),
+		ID:       t.durable,
+		Priority: t.priority,
+		Created:  t.createdAt,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := q.w.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	q.daemons[t.daemon.String()] = t.daemon
+	q.spilled++
+
+	return nil
+}
+
+// restore reads the next task from the queue file. It returns nil if the task
+// could not be restored.
+func (q *diskQueue) restore() *Task {
+	line, err := q.reader.ReadBytes('\n')
+	if err != nil {
+		// Written records are complete lines, the file is broken
+		q.spilled = 0
+		q.truncate()
+		return nil
+	}
+	q.spilled--
+	if q.spilled == 0 {
+		q.truncate()
+	}
+
+	var r diskRecord
+	if err := json.Unmarshal(line, &r); err != nil {
+		return nil
+	}
+	d, ok := q.daemons[r.Daemon]
+	if !ok {
+		return nil
+	}
+	h, err := d.base().taskHandler(r.Type)
+	if err != nil {
+		return nil
+	}
+	t := d.base().newTask(durableActor(h, r.Payload), []TaskOption{
+		withDurable(r.ID, r.Type, r.Payload),
+		WithPriority(r.Priority),
+	})
+	t.createdAt = r.Created
+	t.queue = q
+
+	return t
+}
+
+// truncate empties the queue file once all spilled tasks are read.
+func (q *diskQueue) truncate() {
+	if q.w == nil {
+		return
+	}
+	q.w.Truncate(0)
+	q.w.Seek(0, io.SeekStart)
+	q.r.Seek(0, io.SeekStart)
+	q.reader.Reset(q.r)
+}
+
+// removeFile closes and removes the queue file.
+func (q *diskQueue) removeFile() {
+	if q.w == nil {
+		return
+	}
+	q.w.Close()
+	q.r.Close()
+	os.Remove(q.path)
+	q.w, q.r, q.reader = nil, nil, nil
+}
+
+// spillable returns true if a task could be restored from its type and
+// payload.
+func spillable(t *Task) bool {
+	if t.durable == 0 || t.system || t.attempt > 0 || t.future != nil || t.job != nil || t.unique != "" {
+		return false
+	}
+	if _, ok := t.payload.(json.RawMessage); !ok {
+		return false
+	}
+
+	return t.retry == t.daemon.base().retry
+}
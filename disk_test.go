@@ -0,0 +1,127 @@
+package shezmu
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDiskQueue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shezmu")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	d := &testDaemon{BaseDaemon{name: "test"}}
+	d.self = d
+	var handled []string
+	h := func(ctx context.Context, payload []byte) error {
+		handled = append(handled, string(payload))
+		return nil
+	}
+	d.RegisterTaskType("send", h)
+	durable := func(id uint64) *Task {
+		payload := []byte(fmt.Sprintf(`{"id":%d}`, id))
+		return d.newTask(durableActor(h, payload), []TaskOption{withDurable(id, "send", payload)})
+	}
+
+	path := filepath.Join(dir, "queue.jsonl")
+	q := newDiskQueue(path, 4, 1)
+	t1, t2, t3 := durable(1), durable(2), durable(3)
+	plain := d.newTask(contextActor(func() {}), nil)
+	for _, qt := range []*Task{t1, t2, t3, plain} {
+		if _, err := q.Push(qt, OverflowReject); err != nil {
+			t.Fatalf("Failed to push task: %s", err.Error())
+		}
+	}
+	if _, err := q.Push(durable(4), OverflowReject); err != ErrQueueFull {
+		t.Errorf("Expected spilled tasks to count towards capacity, got %v", err)
+	}
+	if l := q.Len(); l != 4 {
+		t.Errorf("Expected queue length to be 4, got %d", l)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("Expected tasks to be written to disk: %s", err.Error())
+	}
+
+	// Tasks kept in memory are taken first
+	for i, exp := range []*Task{t1, plain} {
+		if next, _ := q.Pop(); next != exp {
+			t.Errorf("Expected task #%d to be taken from memory", i)
+		}
+	}
+	for _, id := range []uint64{2, 3} {
+		next, ok := q.Pop()
+		if !ok {
+			t.Fatalf("Expected task %d to be restored from disk", id)
+		}
+		if next.durable != id || next.name != "send" || next.daemon != Daemon(d) {
+			t.Errorf("Unexpected restored task: %+v", next)
+		}
+		next.actor(context.Background())
+	}
+	if exp := []string{`{"id":2}`, `{"id":3}`}; len(handled) != 2 || handled[0] != exp[0] || handled[1] != exp[1] {
+		t.Errorf("Expected restored tasks to be processed with payloads %v, got %v", exp, handled)
+	}
+
+	q.Close()
+	if _, ok := q.Pop(); ok {
+		t.Error("Expected closed queue to be empty")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Expected queue file to be removed")
+	}
+}
+
+func TestDiskQueueAbandon(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shezmu")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	d := &durableDaemon{BaseDaemon: BaseDaemon{name: "test"}, payloads: make(chan string, 3)}
+	w, err := OpenWAL(filepath.Join(dir, "tasks.wal"))
+	if err != nil {
+		t.Fatalf("Failed to open WAL: %s", err.Error())
+	}
+	defer w.Close()
+	s := newTestShezmu(d)
+	s.WAL = w
+	s.NumWorkers = 1
+	s.NewQueue = NewDiskQueue(dir, 1)
+	s.StartDaemons()
+	waitStarted(d)
+
+	block := make(chan struct{})
+	running := make(chan struct{})
+	d.Process(func() {
+		close(running)
+		<-block
+	})
+	<-running
+	for i := 0; i < 3; i++ {
+		d.ProcessDurable("send", i)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	report, _ := s.StopDaemonsWithTimeout(ctx)
+	close(block)
+
+	if len(report.Abandoned) != 3 {
+		t.Errorf("Expected tasks kept in memory and on disk to be abandoned, got %v", report.Abandoned)
+	}
+	// Abandoned durable tasks are replayed on the next start
+	if n := w.Pending(); n != 3 {
+		t.Errorf("Expected abandoned tasks to stay in the log, %d are pending", n)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "queue-*"))
+	if len(files) != 0 {
+		t.Errorf("Expected queue files to be removed, got %v", files)
+	}
+}
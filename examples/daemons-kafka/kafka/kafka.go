@@ -90,8 +90,8 @@ func (s Subscriber) Subscribe(consumerName, topic string) consumer.Streamer {
 		messages: make(chan []byte),
 		shutdown: make(chan struct{}),
 	}
+	stream.wg.Add(1)
 	go func() {
-		stream.wg.Add(1)
 		defer stream.wg.Done()
 		defer pc.Close()
 		for {
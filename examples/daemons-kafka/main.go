@@ -2,10 +2,8 @@ package main
 
 import (
 	"flag"
-	"os"
-	"os/signal"
 	"strings"
-	"syscall"
+	"time"
 
 	"github.com/localhots/shezmu"
 	"github.com/localhots/shezmu/examples/daemons-kafka/daemons"
@@ -32,20 +30,11 @@ func main() {
 
 	s := shezmu.Summon()
 	s.DaemonStats = stats.NewGroup(statsLogger, statsServer)
+	s.ShutdownTimeout = 10 * time.Second
 
 	s.AddDaemon(&daemons.NumberPrinter{})
 	s.AddDaemon(&daemons.PriceConsumer{})
 
 	s.StartDaemons()
-	defer s.StopDaemons()
-
-	sig := make(chan os.Signal)
-	signal.Notify(sig, syscall.SIGINT, syscall.SIGHUP)
-	switch <-sig {
-	case syscall.SIGHUP:
-		s.StopDaemons()
-		s.StartDaemons()
-	case syscall.SIGINT:
-		return
-	}
+	s.HandleSignals()
 }
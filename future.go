@@ -0,0 +1,129 @@
+package shezmu
+
+import (
+	"context"
+	"fmt"
+)
+
+// Future is a result of a task created by Submit that will be available once
+// the task is processed.
+type Future struct {
+	done   chan struct{}
+	result interface{}
+	err    error
+	panic  interface{}
+}
+
+// PanicError is returned by Future and ProcessWait when an actor panics.
+type PanicError struct {
+	// Value is the recovered panic value.
+	Value interface{}
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("Actor panicked: %v", e.Value)
+}
+
+func newFuture() *Future {
+	return &Future{done: make(chan struct{})}
+}
+
+// Submit creates a task that returns a value and then adds it to processing
+// queue. The returned future is resolved when the task is processed or
+// dropped.
+func (d *BaseDaemon) Submit(fn func() (interface{}, error), opts ...TaskOption) *Future {
+	f := newFuture()
+	actor := func(ctx context.Context) error {
+		val, err := fn()
+		f.result = val
+		return err
+	}
+	d.ProcessContext(actor, append(opts, withFuture(f))...)
+
+	return f
+}
+
+// ProcessWait creates a task, adds it to processing queue and waits for it to
+// be processed. It returns the error returned by the actor, a *PanicError if it
+// panicked or a queue error if the task was dropped.
+func (d *BaseDaemon) ProcessWait(a ContextActor, opts ...TaskOption) error {
+	f := newFuture()
+	d.ProcessContext(a, append(opts, withFuture(f))...)
+	_, err := f.Wait()
+
+	return err
+}
+
+func withFuture(f *Future) TaskOption {
+	return func(t *Task) {
+		t.future = f
+	}
+}
+
+// Wait blocks until the task is processed and returns its result.
+func (f *Future) Wait() (interface{}, error) {
+	<-f.done
+	return f.result, f.err
+}
+
+// WaitContext blocks until the task is processed or the context is done, in
+// which case the context error is returned. The task itself is not cancelled.
+func (f *Future) WaitContext(ctx context.Context) (interface{}, error) {
+	select {
+	case <-f.done:
+		return f.result, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Done returns a channel that is closed when the task is processed.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Result returns the value returned by the task or nil if the task is not
+// processed yet.
+func (f *Future) Result() interface{} {
+	if !f.resolved() {
+		return nil
+	}
+
+	return f.result
+}
+
+// Err returns the error of the task or nil if the task is not processed yet.
+func (f *Future) Err() error {
+	if !f.resolved() {
+		return nil
+	}
+
+	return f.err
+}
+
+// Panic returns the recovered panic value if the task panicked.
+func (f *Future) Panic() interface{} {
+	if !f.resolved() {
+		return nil
+	}
+
+	return f.panic
+}
+
+func (f *Future) resolved() bool {
+	select {
+	case <-f.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (f *Future) resolve(err error, val interface{}) {
+	if val != nil {
+		f.panic = val
+		err = &PanicError{Value: val}
+	}
+	f.err = err
+	close(f.done)
+}
@@ -0,0 +1,88 @@
+package shezmu
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFuture(t *testing.T) {
+	d := &testDaemon{BaseDaemon{name: "test"}}
+	d.HandlePanics(func(error) {})
+	s := newTestShezmu(d)
+	s.StartDaemons()
+	defer s.StopDaemons()
+
+	f := d.Submit(func() (interface{}, error) { return 42, nil })
+	if val, err := f.Wait(); val != 42 || err != nil {
+		t.Errorf("Expected future to be resolved with 42, got %v, %v", val, err)
+	}
+
+	errTask := errors.New("task failed")
+	f = d.Submit(func() (interface{}, error) { return nil, errTask })
+	if _, err := f.Wait(); err != errTask || f.Err() != errTask {
+		t.Errorf("Expected future to be resolved with the task error, got %v", err)
+	}
+
+	err := d.ProcessWait(func(context.Context) error { panic("oops") })
+	if perr, ok := err.(*PanicError); !ok || perr.Value != "oops" {
+		t.Errorf("Expected panic to be returned as *PanicError, got %v", err)
+	}
+}
+
+func TestFutureDropped(t *testing.T) {
+	d := &testDaemon{BaseDaemon{name: "test"}}
+	d.HandleOverflow(OverflowDropNewest)
+	s := newTestShezmu(d)
+	s.NumWorkers = 1
+	s.QueueSize = 1
+	s.StartDaemons()
+	defer s.StopDaemons()
+	if started, _ := d.startedChan(); started != nil {
+		<-started
+	}
+
+	block := make(chan struct{})
+	running := make(chan struct{})
+	d.Process(func() {
+		close(running)
+		<-block
+	})
+	<-running
+	queued := d.Submit(func() (interface{}, error) { return nil, nil })
+	dropped := d.Submit(func() (interface{}, error) { return nil, nil })
+	if _, err := dropped.Wait(); err != ErrQueueFull {
+		t.Errorf("Expected dropped task future to be resolved with ErrQueueFull, got %v", err)
+	}
+	close(block)
+	if _, err := queued.Wait(); err != nil {
+		t.Errorf("Expected queued task to be processed, got %v", err)
+	}
+}
+
+func TestFutureWaitContext(t *testing.T) {
+	d := &testDaemon{BaseDaemon{name: "test"}}
+	s := newTestShezmu(d)
+	s.StartDaemons()
+	defer s.StopDaemons()
+
+	block := make(chan struct{})
+	f := d.Submit(func() (interface{}, error) {
+		<-block
+		return 1, nil
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := f.WaitContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected wait to time out, got %v", err)
+	}
+	if f.Result() != nil {
+		t.Error("Expected future not to be resolved")
+	}
+
+	close(block)
+	if val, err := f.Wait(); val != 1 || err != nil {
+		t.Errorf("Expected future to be resolved after timeout, got %v, %v", val, err)
+	}
+}
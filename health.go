@@ -0,0 +1,277 @@
+package shezmu
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// HealthChecker is an optional interface that daemons can implement to report
+// their health. It is polled periodically by Shezmu while the daemon is
+// running, the context is cancelled when the check times out.
+type HealthChecker interface {
+	Health(ctx context.Context) error
+}
+
+// HealthState describes the health of a daemon.
+type HealthState int
+
+const (
+	// HealthStarting means the daemon Startup function has not finished yet.
+	HealthStarting HealthState = iota
+	// HealthHealthy means the daemon is running and its last health check
+	// succeeded.
+	HealthHealthy
+	// HealthDegraded means the daemon is running but its last health check
+	// failed or one of its system tasks is crash looping.
+	HealthDegraded
+	// HealthFailed means the daemon exhausted its restart budget.
+	HealthFailed
+	// HealthStopped means the daemon is not running.
+	HealthStopped
+	// HealthPaused means the daemon is paused with PauseDaemon.
+	HealthPaused
+)
+
+const (
+	// DefaultHealthCheckInterval is the default interval between daemon health
+	// checks.
+	DefaultHealthCheckInterval = 10 * time.Second
+	// DefaultHealthCheckTimeout is the default time limit of a single daemon
+	// health check.
+	DefaultHealthCheckTimeout = 5 * time.Second
+)
+
+// DaemonHealth describes the health of a single daemon.
+type DaemonHealth struct {
+	Name  string
+	State HealthState
+	// Error is the reason the daemon is degraded or failed.
+	Error error
+	// CheckedAt is the time of the last health check, it is zero if the
+	// daemon does not implement HealthChecker.
+	CheckedAt time.Time
+}
+
+// HealthReport combines health states of all daemons.
+type HealthReport struct {
+	// Live is false if daemons are not running or one of them has failed and
+	// the process should be restarted.
+	Live bool
+	// Ready is true if daemons are running and all of them are healthy.
+	// Daemons that were stopped with StopDaemon or paused with PauseDaemon are
+	// not taken into account.
+	Ready bool
+	// Daemons contains health of every registered daemon sorted by name.
+	Daemons []DaemonHealth
+}
+
+// daemonHealth keeps the results of daemon health checks and crashes.
+type daemonHealth struct {
+	sync.Mutex
+	err       error
+	checkedAt time.Time
+	// crash is the error of a system task that keeps crashing, it is cleared
+	// once the task runs long enough to be considered recovered
+	crash     error
+	crashedAt time.Time
+	recovery  time.Duration
+}
+
+func (s HealthState) String() string {
+	switch s {
+	case HealthStarting:
+		return "starting"
+	case HealthHealthy:
+		return "healthy"
+	case HealthDegraded:
+		return "degraded"
+	case HealthFailed:
+		return "failed"
+	case HealthStopped:
+		return "stopped"
+	case HealthPaused:
+		return "paused"
+	default:
+		return fmt.Sprintf("HealthState(%d)", int(s))
+	}
+}
+
+// Health returns the health of all registered daemons.
+func (s *Shezmu) Health() *HealthReport {
+	s.mu.Lock()
+	running := s.running
+	s.mu.Unlock()
+
+	r := &HealthReport{Live: running, Ready: running}
+	for _, d := range s.daemonList() {
+		h := d.base().health()
+		switch h.State {
+		case HealthFailed:
+			r.Live = false
+			r.Ready = false
+		case HealthStarting, HealthDegraded:
+			r.Ready = false
+		}
+		r.Daemons = append(r.Daemons, h)
+	}
+	sort.Sort(daemonHealthByName(r.Daemons))
+
+	return r
+}
+
+// healthChecks periodically checks the health of running daemons that
+// implement HealthChecker. It returns when daemons are stopped.
+func (s *Shezmu) healthChecks() {
+	stopped := s.stopped()
+	interval := s.HealthCheckInterval
+	if interval <= 0 {
+		interval = DefaultHealthCheckInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopped:
+			return
+		case <-ticker.C:
+			var wg sync.WaitGroup
+			for _, d := range s.daemonList() {
+				hc, ok := d.(HealthChecker)
+				if !ok || d.base().health().State == HealthStopped {
+					continue
+				}
+				wg.Add(1)
+				go func(d Daemon, hc HealthChecker) {
+					defer wg.Done()
+					s.checkHealth(d, hc)
+				}(d, hc)
+			}
+			wg.Wait()
+		}
+	}
+}
+
+// checkHealth runs a single health check of a daemon. Checks that do not
+// respect context cancellation are abandoned after the timeout.
+func (s *Shezmu) checkHealth(d Daemon, hc HealthChecker) {
+	timeout := s.HealthCheckTimeout
+	if timeout <= 0 {
+		timeout = DefaultHealthCheckTimeout
+	}
+	ctx, cancel := context.WithTimeout(d.base().Context(), timeout)
+	defer cancel()
+
+	res := make(chan error, 1)
+	go func() {
+		defer func() {
+			if val := recover(); val != nil {
+				res <- interfaceToError(val)
+			}
+		}()
+		res <- hc.Health(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-res:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	h := &d.base().healthState
+	h.Lock()
+	prev := h.err
+	h.err = err
+	h.checkedAt = time.Now()
+	h.Unlock()
+
+	if err != nil && prev == nil {
+		d.base().log(LevelWarn, "Health check failed", F("error", err))
+	} else if err == nil && prev != nil {
+		d.base().log(LevelInfo, "Health check succeeded")
+	}
+}
+
+// markCrashLoop marks the daemon degraded because one of its system tasks
+// keeps crashing. The mark is cleared if the daemon does not crash within
+// recovery duration or when the daemon is restarted.
+func (d *BaseDaemon) markCrashLoop(err error, recovery time.Duration) {
+	h := &d.healthState
+	h.Lock()
+	defer h.Unlock()
+
+	h.crash = err
+	h.crashedAt = time.Now()
+	h.recovery = recovery
+}
+
+// resetHealth clears the results of health checks and crashes.
+func (d *BaseDaemon) resetHealth() {
+	h := &d.healthState
+	h.Lock()
+	defer h.Unlock()
+
+	h.err = nil
+	h.checkedAt = time.Time{}
+	h.crash = nil
+}
+
+// health returns the current health of the daemon.
+func (d *BaseDaemon) health() DaemonHealth {
+	dh := DaemonHealth{Name: d.String()}
+
+	l := &d.lifecycle
+	l.Lock()
+	running, failed, started := l.running, l.failed, l.started
+	l.Unlock()
+	paused := d.IsPaused()
+
+	h := &d.healthState
+	h.Lock()
+	defer h.Unlock()
+	dh.CheckedAt = h.checkedAt
+
+	switch {
+	case failed:
+		dh.State = HealthFailed
+		dh.Error = h.crash
+	case !running:
+		dh.State = HealthStopped
+	case paused:
+		dh.State = HealthPaused
+	case !isClosed(started):
+		dh.State = HealthStarting
+	case h.crash != nil && (h.recovery <= 0 || time.Now().Sub(h.crashedAt) <= h.recovery):
+		dh.State = HealthDegraded
+		dh.Error = h.crash
+	case h.err != nil:
+		dh.State = HealthDegraded
+		dh.Error = h.err
+	default:
+		dh.State = HealthHealthy
+	}
+
+	return dh
+}
+
+func isClosed(ch <-chan struct{}) bool {
+	if ch == nil {
+		return false
+	}
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+type daemonHealthByName []DaemonHealth
+
+func (h daemonHealthByName) Len() int           { return len(h) }
+func (h daemonHealthByName) Less(i, j int) bool { return h[i].Name < h[j].Name }
+func (h daemonHealthByName) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
@@ -0,0 +1,122 @@
+package shezmu
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type checkerDaemon struct {
+	BaseDaemon
+	mu   sync.Mutex
+	err  error
+	hang bool
+}
+
+func (d *checkerDaemon) Health(ctx context.Context) error {
+	d.mu.Lock()
+	err, hang := d.err, d.hang
+	d.mu.Unlock()
+
+	if hang {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return err
+}
+
+func (d *checkerDaemon) set(err error, hang bool) {
+	d.mu.Lock()
+	d.err, d.hang = err, hang
+	d.mu.Unlock()
+}
+
+func TestDaemonHealth(t *testing.T) {
+	d := &BaseDaemon{name: "test"}
+	check := func(exp HealthState) {
+		if s := d.health().State; s != exp {
+			t.Fatalf("Expected daemon to be %s, got %s", exp, s)
+		}
+	}
+
+	check(HealthStopped)
+	d.start(newPriorityQueue(10))
+	check(HealthStarting)
+	d.markStarted()
+	check(HealthHealthy)
+
+	errCrash := errors.New("crash")
+	d.markCrashLoop(errCrash, time.Millisecond)
+	check(HealthDegraded)
+	if err := d.health().Error; err != errCrash {
+		t.Errorf("Expected crash error, got %v", err)
+	}
+	time.Sleep(2 * time.Millisecond)
+	check(HealthHealthy)
+
+	d.healthState.err = errors.New("unhealthy")
+	check(HealthDegraded)
+
+	d.stop()
+	check(HealthStopped)
+	d.fail(errCrash)
+	check(HealthFailed)
+
+	d.start(newPriorityQueue(10))
+	d.markStarted()
+	check(HealthHealthy)
+}
+
+func TestHealthStateString(t *testing.T) {
+	if s := HealthDegraded.String(); s != "degraded" {
+		t.Errorf("Unexpected state name: %s", s)
+	}
+	if s := HealthState(42).String(); s != "HealthState(42)" {
+		t.Errorf("Unexpected state name: %s", s)
+	}
+}
+
+func TestHealthChecks(t *testing.T) {
+	d := &checkerDaemon{BaseDaemon: BaseDaemon{name: "test"}}
+	s := newTestShezmu(d)
+	s.HealthCheckInterval = 5 * time.Millisecond
+	s.HealthCheckTimeout = 5 * time.Millisecond
+	s.StartDaemons()
+	defer s.StopDaemons()
+	waitStarted(d)
+
+	// waitHealth waits for the result of a health check made after it was
+	// called.
+	waitHealth := func(exp HealthState, expErr error) {
+		since := time.Now()
+		deadline := since.Add(time.Second)
+		for time.Now().Before(deadline) {
+			if h := d.health(); h.CheckedAt.After(since) && h.State == exp && h.Error == expErr {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+		h := d.health()
+		t.Fatalf("Expected daemon to be %s with error %v, got %s with %v", exp, expErr, h.State, h.Error)
+	}
+
+	waitHealth(HealthHealthy, nil)
+	if r := s.Health(); !r.Ready {
+		t.Error("Expected health report to be ready")
+	}
+
+	errUnhealthy := errors.New("unhealthy")
+	d.set(errUnhealthy, false)
+	waitHealth(HealthDegraded, errUnhealthy)
+	if r := s.Health(); r.Ready || !r.Live {
+		t.Errorf("Expected health report to be live but not ready, got %+v", r)
+	}
+
+	d.set(nil, true)
+	waitHealth(HealthDegraded, context.DeadlineExceeded)
+
+	d.set(nil, false)
+	waitHealth(HealthHealthy, nil)
+}
@@ -1,6 +1,7 @@
 package http
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 
@@ -34,7 +35,7 @@ func NewServer(sv *shezmu.Shezmu, address string) *Server {
 
 // Start starts the server.
 func (s *Server) Start() error {
-	s.sv.Logger.Printf("Starting server at %s", s.address)
+	s.sv.Logger.Log(shezmu.LevelInfo, "Starting server", shezmu.F("address", s.address))
 	return http.ListenAndServe(s.address, s.router)
 }
 
@@ -69,12 +70,17 @@ func (s *Server) addHandlerDaemon(path string, handle hr.Handle) hr.Handle {
 }
 
 func (h *handler) process(w http.ResponseWriter, r *http.Request, params hr.Params) {
-	wait := make(chan struct{})
-	h.Process(func() {
-		defer close(wait)
+	err := h.ProcessWait(func(context.Context) error {
 		h.handle(w, r, params)
+		return nil
 	})
-	<-wait
+	switch err.(type) {
+	case nil:
+	case *shezmu.PanicError:
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	default:
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+	}
 }
 
 func (h *handler) String() string {
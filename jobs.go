@@ -0,0 +1,222 @@
+package shezmu
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// OverlapPolicy defines what happens when a periodic job is due while its
+// previous run is still in progress.
+type OverlapPolicy int
+
+const (
+	// OverlapSkip skips the run.
+	OverlapSkip OverlapPolicy = iota
+	// OverlapQueue postpones the run until the previous one is finished. At
+	// most one run is postponed, following runs are skipped until it starts.
+	OverlapQueue
+	// OverlapAllow runs the job concurrently with the previous run.
+	OverlapAllow
+)
+
+// JobOption is a function that modifies a periodic job created by Every or
+// Cron.
+type JobOption func(*Job)
+
+// WithOverlap sets the overlap policy of a periodic job. Default policy is
+// OverlapSkip.
+func WithOverlap(p OverlapPolicy) JobOption {
+	return func(j *Job) {
+		j.overlap = p
+	}
+}
+
+// WithJitter delays every run of a periodic job by a random duration up to
+// given maximum.
+func WithJitter(max time.Duration) JobOption {
+	return func(j *Job) {
+		j.jitter = max
+	}
+}
+
+// WithJobPriority sets the priority of tasks created by a periodic job.
+func WithJobPriority(p Priority) JobOption {
+	return func(j *Job) {
+		j.priority = &p
+	}
+}
+
+// Job is a periodic job created by Every or Cron. Every run of the job is a
+// regular task processed by workers. Jobs are stopped when the daemon stops.
+type Job struct {
+	mu       sync.Mutex
+	daemon   *BaseDaemon
+	actor    ContextActor
+	schedule Schedule
+	overlap  OverlapPolicy
+	jitter   time.Duration
+	priority *Priority
+	name     string
+
+	last    time.Time
+	timer   *DelayedTask
+	running int
+	pending int
+	stopped bool
+}
+
+// Every creates a job that runs an actor periodically with given interval
+// between runs. An error is returned if the interval is not positive.
+func (d *BaseDaemon) Every(interval time.Duration, a ContextActor, opts ...JobOption) (*Job, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("Invalid job interval: %s", interval)
+	}
+
+	return d.newJob(everySchedule(interval), a, opts), nil
+}
+
+// Cron creates a job that runs an actor according to a cron expression. See
+// ParseCron for supported syntax.
+func (d *BaseDaemon) Cron(expr string, a ContextActor, opts ...JobOption) (*Job, error) {
+	sched, err := ParseCron(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.newJob(sched, a, opts), nil
+}
+
+func (d *BaseDaemon) newJob(sched Schedule, a ContextActor, opts []JobOption) *Job {
+	j := &Job{
+		daemon:   d,
+		actor:    a,
+		schedule: sched,
+		name:     fmt.Sprint(sched),
+		last:     time.Now(),
+	}
+	for _, opt := range opts {
+		opt(j)
+	}
+
+	d.lifecycle.Lock()
+	d.jobs = append(d.jobs, j)
+	d.lifecycle.Unlock()
+
+	j.mu.Lock()
+	j.scheduleNext(j.last)
+	j.mu.Unlock()
+
+	return j
+}
+
+// Stop cancels all future runs of the job. Runs that are already in progress
+// are not interrupted.
+func (j *Job) Stop() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.stopped = true
+	j.pending = 0
+	if j.timer != nil {
+		j.timer.Cancel()
+	}
+}
+
+// scheduleNext adds the next activation of the job to the timer heap. Missed
+// activations are skipped.
+func (j *Job) scheduleNext(now time.Time) {
+	next := j.schedule.Next(j.last)
+	if next.Before(now) {
+		next = j.schedule.Next(now)
+	}
+	if next.IsZero() {
+		j.timer = nil
+		return
+	}
+	j.last = next
+
+	at := next
+	if j.jitter > 0 {
+		at = at.Add(time.Duration(rand.Int63n(int64(j.jitter))))
+	}
+	t := &Task{daemon: j.daemon.self, name: j.name}
+	j.timer = j.daemon.shezmu.timers.addJob(t, j, at)
+}
+
+// fire is called by the timer loop when the job is due.
+func (j *Job) fire() {
+	j.mu.Lock()
+	if j.stopped {
+		j.mu.Unlock()
+		return
+	}
+	j.scheduleNext(time.Now())
+
+	run := true
+	if j.running > 0 {
+		switch j.overlap {
+		case OverlapSkip:
+			j.daemon.log(LevelWarn, "Skipping job because previous run is still in progress", F("job", j.name))
+			run = false
+		case OverlapQueue:
+			if j.pending == 0 {
+				j.pending++
+			} else {
+				j.daemon.log(LevelWarn, "Skipping job because another run is already queued", F("job", j.name))
+			}
+			run = false
+		}
+	}
+	if run {
+		j.running++
+	}
+	j.mu.Unlock()
+
+	if run {
+		j.enqueue()
+	}
+}
+
+func (j *Job) enqueue() {
+	d := j.daemon
+	d.waitRate()
+
+	t := d.newTask(j.actor, nil)
+	t.name = j.name
+	t.job = j
+	if j.priority != nil {
+		t.priority = *j.priority
+	}
+	d.tryEnqueue(t)
+}
+
+// done is called when a run of the job is finished or its task is dropped.
+// It starts a postponed run if there is one.
+func (j *Job) done() {
+	j.mu.Lock()
+	j.running--
+	run := j.pending > 0 && !j.stopped
+	if run {
+		j.pending--
+		j.running++
+	}
+	j.mu.Unlock()
+
+	if run {
+		j.enqueue()
+	}
+}
+
+// stopJobs stops all periodic jobs of the daemon.
+func (d *BaseDaemon) stopJobs() {
+	d.lifecycle.Lock()
+	jobs := d.jobs
+	d.jobs = nil
+	d.lifecycle.Unlock()
+
+	for _, j := range jobs {
+		j.Stop()
+	}
+}
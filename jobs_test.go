@@ -0,0 +1,115 @@
+package shezmu
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEveryInvalidInterval(t *testing.T) {
+	d := &testDaemon{BaseDaemon{name: "test"}}
+	newTestShezmu(d)
+
+	for _, interval := range []time.Duration{0, -time.Second} {
+		if j, err := d.Every(interval, func(context.Context) error { return nil }); j != nil || err == nil {
+			t.Errorf("Expected interval %s to be rejected, got %v", interval, err)
+		}
+	}
+}
+
+func TestEveryStopsWithDaemon(t *testing.T) {
+	d := &testDaemon{BaseDaemon{name: "test"}}
+	s := newTestShezmu(d)
+	s.StartDaemons()
+	defer s.StopDaemons()
+	waitStarted(d)
+
+	var runs int64
+	_, err := d.Every(5*time.Millisecond, func(context.Context) error {
+		atomic.AddInt64(&runs, 1)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to create job: %s", err.Error())
+	}
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt64(&runs) < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := atomic.LoadInt64(&runs); n < 2 {
+		t.Fatalf("Expected job to run periodically, ran %d times", n)
+	}
+
+	s.StopDaemon("test")
+	n := atomic.LoadInt64(&runs)
+	time.Sleep(20 * time.Millisecond)
+	if m := atomic.LoadInt64(&runs); m != n {
+		t.Errorf("Expected job to stop along with the daemon, ran %d more times", m-n)
+	}
+	if l := s.timers.len(); l != 0 {
+		t.Errorf("Expected next run to be removed from the schedule, %d are pending", l)
+	}
+}
+
+func TestJobOverlap(t *testing.T) {
+	table := []struct {
+		policy  OverlapPolicy
+		running func(n int64) bool
+		pending int
+	}{
+		{OverlapSkip, func(n int64) bool { return n == 1 }, 0},
+		{OverlapQueue, func(n int64) bool { return n == 1 }, 1},
+		{OverlapAllow, func(n int64) bool { return n > 1 }, 0},
+	}
+
+	for _, test := range table {
+		d := &testDaemon{BaseDaemon{name: "test"}}
+		s := newTestShezmu(d)
+		s.NumWorkers = 4
+		s.StartDaemons()
+		waitStarted(d)
+
+		var running int64
+		block := make(chan struct{})
+		j, err := d.Every(5*time.Millisecond, func(context.Context) error {
+			atomic.AddInt64(&running, 1)
+			<-block
+			return nil
+		}, WithOverlap(test.policy))
+		if err != nil {
+			t.Fatalf("Failed to create job: %s", err.Error())
+		}
+		// First run blocks while several more are due
+		time.Sleep(40 * time.Millisecond)
+
+		if n := atomic.LoadInt64(&running); !test.running(n) {
+			t.Errorf("Unexpected number of runs with policy %d: %d", test.policy, n)
+		}
+		j.mu.Lock()
+		pending := j.pending
+		j.mu.Unlock()
+		if pending != test.pending {
+			t.Errorf("Expected %d postponed runs with policy %d, got %d", test.pending, test.policy, pending)
+		}
+		close(block)
+		s.StopDaemons()
+	}
+}
+
+func TestJobJitter(t *testing.T) {
+	d := &testDaemon{BaseDaemon{name: "test"}}
+	newTestShezmu(d)
+
+	jitter := time.Minute
+	for i := 0; i < 10; i++ {
+		j, err := d.Every(time.Hour, func(context.Context) error { return nil }, WithJitter(jitter))
+		if err != nil {
+			t.Fatalf("Failed to create job: %s", err.Error())
+		}
+		if delay := j.timer.at.Sub(j.last); delay < 0 || delay >= jitter {
+			t.Errorf("Expected run to be delayed by less than %s, got %s", jitter, delay)
+		}
+		j.Stop()
+	}
+}
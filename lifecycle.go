@@ -0,0 +1,224 @@
+package shezmu
+
+import (
+	"fmt"
+	"runtime/debug"
+	"time"
+)
+
+// DaemonState is a state of the daemon lifecycle.
+type DaemonState int
+
+const (
+	// StateStopped means the daemon was never started or was stopped.
+	StateStopped DaemonState = iota
+	// StateStarting means the daemon Startup function has not finished yet.
+	StateStarting
+	// StateRunning means the daemon has started and processes tasks.
+	StateRunning
+	// StateStopping means the daemon shutdown was requested and its system
+	// tasks are finishing.
+	StateStopping
+	// StateCrashed means one of the daemon system tasks has crashed and is
+	// waiting to be restarted.
+	StateCrashed
+	// StateFailed means the daemon exhausted its restart budget.
+	StateFailed
+)
+
+// stateTransitions lists valid transitions between daemon states.
+var stateTransitions = map[DaemonState][]DaemonState{
+	StateStopped:  {StateStarting, StateFailed},
+	StateStarting: {StateRunning, StateStopping, StateCrashed, StateFailed},
+	StateRunning:  {StateStopping, StateCrashed, StateFailed},
+	StateStopping: {StateStopped, StateStarting, StateFailed},
+	StateCrashed:  {StateStarting, StateRunning, StateStopping, StateFailed},
+	StateFailed:   {StateStarting},
+}
+
+// EventType is the type of a lifecycle event.
+type EventType int
+
+const (
+	// EventStateChanged is emitted when a daemon changes its state.
+	EventStateChanged EventType = iota
+	// EventRestart is emitted when a crashed system task is scheduled for
+	// restart.
+	EventRestart
+	// EventPanic is emitted when a task panics.
+	EventPanic
+	// EventRateLimited is emitted when adding a task is delayed by the daemon
+	// rate limit.
+	EventRateLimited
+	// EventPaused is emitted when a daemon is paused.
+	EventPaused
+	// EventResumed is emitted when a daemon is resumed.
+	EventResumed
+)
+
+// Event describes something that happened to a daemon.
+type Event struct {
+	Type   EventType
+	Daemon string
+	Time   time.Time
+	// From and To are the previous and the new states of the daemon, set for
+	// EventStateChanged.
+	From DaemonState
+	To   DaemonState
+	// Task is the name of the task the event is related to.
+	Task string
+	// Err is the error that caused the event, if any.
+	Err error
+	// Delay is the restart delay for EventRestart and the time spent waiting
+	// for EventRateLimited.
+	Delay time.Duration
+}
+
+// EventHandler is a function that receives lifecycle events.
+type EventHandler func(Event)
+
+func (s DaemonState) String() string {
+	switch s {
+	case StateStopped:
+		return "stopped"
+	case StateStarting:
+		return "starting"
+	case StateRunning:
+		return "running"
+	case StateStopping:
+		return "stopping"
+	case StateCrashed:
+		return "crashed"
+	case StateFailed:
+		return "failed"
+	default:
+		return fmt.Sprintf("DaemonState(%d)", int(s))
+	}
+}
+
+func (t EventType) String() string {
+	switch t {
+	case EventStateChanged:
+		return "state changed"
+	case EventRestart:
+		return "restart"
+	case EventPanic:
+		return "panic"
+	case EventRateLimited:
+		return "rate limited"
+	case EventPaused:
+		return "paused"
+	case EventResumed:
+		return "resumed"
+	default:
+		return fmt.Sprintf("EventType(%d)", int(t))
+	}
+}
+
+// OnEvent subscribes a handler to lifecycle events of all daemons. Handlers are
+// called synchronously from the goroutine the event happened in and should
+// return quickly.
+func (s *Shezmu) OnEvent(h EventHandler) {
+	s.events.Lock()
+	defer s.events.Unlock()
+
+	s.events.handlers = append(s.events.handlers, h)
+}
+
+// emit passes an event to all subscribed handlers. Panics in handlers are
+// recovered and logged.
+func (s *Shezmu) emit(e Event) {
+	s.events.Lock()
+	handlers := s.events.handlers
+	s.events.Unlock()
+
+	for _, h := range handlers {
+		func() {
+			defer func() {
+				if val := recover(); val != nil {
+					s.Logger.Log(LevelError, "Event handler recovered from a panic",
+						F("error", interfaceToError(val)), F("stack", debug.Stack()))
+				}
+			}()
+			h(e)
+		}()
+	}
+}
+
+// State returns the current lifecycle state of the daemon.
+func (d *BaseDaemon) State() DaemonState {
+	d.lifecycle.Lock()
+	defer d.lifecycle.Unlock()
+
+	return d.lifecycle.state
+}
+
+// setState changes the state of the daemon. It returns false if the
+// transition is not valid.
+func (d *BaseDaemon) setState(to DaemonState, err error) bool {
+	d.lifecycle.Lock()
+	e, ok := d.transition(to, err)
+	d.lifecycle.Unlock()
+
+	if ok {
+		d.emit(e)
+	}
+	return ok
+}
+
+// transition changes the state of the daemon and returns the event that
+// should be emitted once the lifecycle mutex is unlocked. Must be called with
+// the lifecycle mutex locked.
+func (d *BaseDaemon) transition(to DaemonState, err error) (Event, bool) {
+	from := d.lifecycle.state
+	for _, s := range stateTransitions[from] {
+		if s == to {
+			d.lifecycle.state = to
+			return Event{Type: EventStateChanged, From: from, To: to, Err: err}, true
+		}
+	}
+
+	return Event{}, false
+}
+
+// recoverState moves a crashed daemon back to running or starting state once
+// its system task is restarted.
+func (d *BaseDaemon) recoverState(startup bool) {
+	d.lifecycle.Lock()
+	var e Event
+	var ok bool
+	if d.lifecycle.state == StateCrashed {
+		if startup || !isClosed(d.lifecycle.started) {
+			e, ok = d.transition(StateStarting, nil)
+		} else {
+			e, ok = d.transition(StateRunning, nil)
+		}
+	}
+	d.lifecycle.Unlock()
+
+	if ok {
+		d.emit(e)
+	}
+}
+
+// emit sets the daemon name and time of an event and passes it to Shezmu
+// event handlers.
+func (d *BaseDaemon) emit(e Event) {
+	if d.shezmu == nil {
+		return
+	}
+	e.Daemon = d.String()
+	e.Time = time.Now()
+	d.shezmu.emit(e)
+}
+
+// waitRate blocks until the daemon rate limit allows adding a task.
+func (d *BaseDaemon) waitRate() {
+	if d.limit == nil {
+		return
+	}
+	if wait := d.limit.Take(1); wait > 0 {
+		d.emit(Event{Type: EventRateLimited, Delay: wait})
+		time.Sleep(wait)
+	}
+}
@@ -0,0 +1,70 @@
+package shezmu
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"testing"
+)
+
+func TestDaemonStateTransitions(t *testing.T) {
+	s := Summon()
+	var events []Event
+	s.OnEvent(func(e Event) {
+		events = append(events, e)
+	})
+	d := &BaseDaemon{name: "test", shezmu: s}
+
+	d.start(newPriorityQueue(10))
+	d.markStarted()
+	errCrash := errors.New("crash")
+	if !d.setState(StateCrashed, errCrash) {
+		t.Fatal("Expected running daemon to crash")
+	}
+	d.recoverState(false)
+	d.stop()
+	if d.setState(StateRunning, nil) {
+		t.Fatal("Expected stopping daemon not to become running")
+	}
+	d.setState(StateStopped, nil)
+
+	exp := []DaemonState{StateStarting, StateRunning, StateCrashed, StateRunning, StateStopping, StateStopped}
+	if len(events) != len(exp) {
+		t.Fatalf("Expected %d events, got %d: %v", len(exp), len(events), events)
+	}
+	from := StateStopped
+	for i, e := range events {
+		if e.Type != EventStateChanged || e.Daemon != "test" || e.From != from || e.To != exp[i] {
+			t.Errorf("Unexpected event #%d: %+v", i, e)
+		}
+		from = e.To
+	}
+	if events[2].Err != errCrash {
+		t.Errorf("Expected crash event to carry the error, got %v", events[2].Err)
+	}
+	if st := d.State(); st != StateStopped {
+		t.Errorf("Expected daemon to be stopped, got %s", st)
+	}
+}
+
+func TestDaemonRecoverStateDuringStartup(t *testing.T) {
+	d := &BaseDaemon{name: "test"}
+	d.start(newPriorityQueue(10))
+	d.setState(StateCrashed, nil)
+	d.recoverState(false)
+	if st := d.State(); st != StateStarting {
+		t.Errorf("Expected daemon to be starting, got %s", st)
+	}
+}
+
+func TestEventHandlerPanic(t *testing.T) {
+	s := Summon()
+	s.Logger = NewStdLogger(log.New(ioutil.Discard, "", 0), LevelDebug)
+	var called bool
+	s.OnEvent(func(Event) { panic("oops") })
+	s.OnEvent(func(Event) { called = true })
+	s.emit(Event{})
+	if !called {
+		t.Error("Expected handlers after a panicking one to be called")
+	}
+}
@@ -0,0 +1,200 @@
+package shezmu
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log message.
+type Level int
+
+const (
+	// LevelDebug is used for messages that are only useful when debugging.
+	LevelDebug Level = iota
+	// LevelInfo is used for regular lifecycle messages.
+	LevelInfo
+	// LevelWarn is used for problems that Shezmu has recovered from.
+	LevelWarn
+	// LevelError is used for failures and panics.
+	LevelError
+)
+
+// Field is a key/value pair attached to a log message.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Logger is the interface of a structured leveled logger. Messages are short
+// and constant, variable details such as daemon and task names, attempts,
+// durations, errors and stack traces are passed as fields.
+type Logger interface {
+	Log(level Level, msg string, fields ...Field)
+}
+
+// NopLogger is a logger that discards all messages.
+type NopLogger struct{}
+
+// stdLogger writes messages to a standard library logger.
+type stdLogger struct {
+	logger *log.Logger
+	level  Level
+}
+
+// jsonLogger writes every message as a JSON object on a separate line.
+type jsonLogger struct {
+	mu    sync.Mutex
+	w     io.Writer
+	level Level
+}
+
+// daemonLogger attaches the daemon name field to every message.
+type daemonLogger struct {
+	d *BaseDaemon
+}
+
+// F creates a log field.
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	default:
+		return fmt.Sprintf("Level(%d)", int(l))
+	}
+}
+
+// Log discards the message.
+func (NopLogger) Log(level Level, msg string, fields ...Field) {}
+
+// NewStdLogger creates a logger that writes messages of given level and above
+// to a standard library logger. Fields are written as key=value pairs after
+// the message, a stack trace is written on separate lines.
+func NewStdLogger(l *log.Logger, level Level) Logger {
+	return &stdLogger{logger: l, level: level}
+}
+
+func (l *stdLogger) Log(level Level, msg string, fields ...Field) {
+	if level < l.level {
+		return
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(strings.ToUpper(level.String()))
+	buf.WriteByte(' ')
+	buf.WriteString(msg)
+	var stack string
+	for _, f := range fields {
+		if f.Key == "stack" {
+			stack = fmt.Sprintf("%s", f.Value)
+			continue
+		}
+		buf.WriteByte(' ')
+		buf.WriteString(f.Key)
+		buf.WriteByte('=')
+		buf.WriteString(quoteValue(fmt.Sprint(fieldValue(f.Value))))
+	}
+	if stack != "" {
+		buf.WriteByte('\n')
+		buf.WriteString(strings.TrimRight(stack, "\n"))
+	}
+
+	l.logger.Println(buf.String())
+}
+
+// NewJSONLogger creates a logger that writes messages of given level and above
+// to w as JSON lines. Every line has time, level and msg keys along with the
+// fields of the message.
+func NewJSONLogger(w io.Writer, level Level) Logger {
+	return &jsonLogger{w: w, level: level}
+}
+
+func (l *jsonLogger) Log(level Level, msg string, fields ...Field) {
+	if level < l.level {
+		return
+	}
+
+	m := make(map[string]interface{}, len(fields)+3)
+	for _, f := range fields {
+		m[f.Key] = fieldValue(f.Value)
+	}
+	m["time"] = time.Now().Format(time.RFC3339Nano)
+	m["level"] = level.String()
+	m["msg"] = msg
+
+	line, err := json.Marshal(m)
+	if err != nil {
+		// One of the values could not be encoded, falling back to strings
+		for k, v := range m {
+			m[k] = fmt.Sprint(v)
+		}
+		line, _ = json.Marshal(m)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.w.Write(append(line, '\n'))
+}
+
+// fieldValue converts values that have no useful representation of their own
+// to strings.
+func fieldValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case error:
+		return v.Error()
+	case []byte:
+		return string(v)
+	case time.Duration:
+		return v.String()
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return v
+	}
+}
+
+// quoteValue quotes values that contain spaces, quotes or equal signs.
+func quoteValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		return strconv.Quote(s)
+	}
+
+	return s
+}
+
+// log writes a message with the daemon name field.
+func (d *BaseDaemon) log(level Level, msg string, fields ...Field) {
+	if d.logger != nil {
+		d.logger.Log(level, msg, append([]Field{F("daemon", d.String())}, fields...)...)
+	}
+}
+
+// fields returns log fields that describe the task followed by extra fields.
+func (t *Task) fields(extra ...Field) []Field {
+	fields := []Field{F("daemon", t.daemon.String()), F("task", t.name)}
+	if t.attempt > 0 {
+		fields = append(fields, F("attempt", t.attempt+1))
+	}
+
+	return append(fields, extra...)
+}
+
+func (l daemonLogger) Log(level Level, msg string, fields ...Field) {
+	l.d.log(level, msg, fields...)
+}
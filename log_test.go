@@ -0,0 +1,56 @@
+package shezmu
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewStdLogger(log.New(&buf, "", 0), LevelInfo)
+
+	l.Log(LevelDebug, "Hidden")
+	l.Log(LevelWarn, "Task failed",
+		F("daemon", "Foo"),
+		F("error", errors.New("oh no")),
+		F("duration", 1500*time.Millisecond),
+		F("stack", []byte("goroutine 1 [running]:\nmain.main()\n")))
+
+	exp := "WARN Task failed daemon=Foo error=\"oh no\" duration=1.5s\ngoroutine 1 [running]:\nmain.main()\n"
+	if out := buf.String(); out != exp {
+		t.Errorf("Unexpected output:\n%q\nexpected:\n%q", out, exp)
+	}
+}
+
+func TestJSONLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewJSONLogger(&buf, LevelDebug)
+
+	l.Log(LevelError, "Task failed", F("daemon", "Foo"), F("attempt", 2), F("error", errors.New("oh no")))
+	l.Log(LevelInfo, "Unsupported value", F("ch", make(chan int)))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d:\n%s", len(lines), buf.String())
+	}
+
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["level"] != "error" || m["msg"] != "Task failed" || m["daemon"] != "Foo" || m["attempt"] != 2.0 || m["error"] != "oh no" {
+		t.Errorf("Unexpected message: %v", m)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, m["time"].(string)); err != nil {
+		t.Errorf("Invalid time: %v", err)
+	}
+
+	if err := json.Unmarshal([]byte(lines[1]), &m); err != nil {
+		t.Fatalf("Expected message with unsupported value to be encoded: %v", err)
+	}
+}
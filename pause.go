@@ -0,0 +1,144 @@
+package shezmu
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/localhots/shezmu/stats"
+)
+
+// ErrPaused is returned by TryProcess when the daemon is paused.
+var ErrPaused = errors.New("daemon is paused")
+
+// pauseState keeps track of a paused daemon.
+type pauseState struct {
+	sync.Mutex
+	paused bool
+	// requested is closed when the daemon is paused
+	requested chan struct{}
+	// resumed is closed when the daemon is resumed
+	resumed chan struct{}
+}
+
+// PauseDaemon pauses a running daemon without stopping it. While the daemon is
+// paused its Process calls block, Continue blocks and tasks that were already
+// queued are held without occupying workers. Tasks that are being processed
+// are not interrupted.
+func (s *Shezmu) PauseDaemon(name string) error {
+	d, err := s.lookup(name)
+	if err != nil {
+		return err
+	}
+	base := d.base()
+	if !base.isRunning() {
+		return fmt.Errorf("Daemon %q is not running", name)
+	}
+
+	if base.pause() {
+		base.log(LevelInfo, "Daemon is paused")
+		stats.Pause(s.DaemonStats, d.String())
+		base.emit(Event{Type: EventPaused})
+	}
+	return nil
+}
+
+// ResumeDaemon resumes a paused daemon. Tasks that were held while the daemon
+// was paused are added back to processing queue.
+func (s *Shezmu) ResumeDaemon(name string) error {
+	d, err := s.lookup(name)
+	if err != nil {
+		return err
+	}
+
+	if d.base().resume() {
+		d.base().log(LevelInfo, "Daemon is resumed")
+		stats.Resume(s.DaemonStats, d.String())
+		d.base().emit(Event{Type: EventResumed})
+	}
+	return nil
+}
+
+// PauseRequested returns a channel that is closed the moment the daemon is
+// paused. A new channel is returned once the daemon is resumed.
+func (d *BaseDaemon) PauseRequested() <-chan struct{} {
+	p := &d.pauseState
+	p.Lock()
+	defer p.Unlock()
+
+	if p.requested == nil {
+		p.requested = make(chan struct{})
+	}
+
+	return p.requested
+}
+
+// IsPaused returns true if the daemon is paused.
+func (d *BaseDaemon) IsPaused() bool {
+	d.pauseState.Lock()
+	defer d.pauseState.Unlock()
+
+	return d.pauseState.paused
+}
+
+// pause marks the daemon as paused. It returns false if the daemon is paused
+// already.
+func (d *BaseDaemon) pause() bool {
+	p := &d.pauseState
+	p.Lock()
+	defer p.Unlock()
+
+	if p.paused {
+		return false
+	}
+	p.paused = true
+	if p.requested == nil {
+		p.requested = make(chan struct{})
+	}
+	close(p.requested)
+	p.resumed = make(chan struct{})
+
+	return true
+}
+
+// resume marks the daemon as not paused and adds held tasks back to the queue.
+// It returns false if the daemon is not paused.
+func (d *BaseDaemon) resume() bool {
+	p := &d.pauseState
+	p.Lock()
+	if !p.paused {
+		p.Unlock()
+		return false
+	}
+	p.paused = false
+	p.requested = make(chan struct{})
+	close(p.resumed)
+	p.Unlock()
+
+	// Held tasks are taken after the flag is cleared, so that no task could be
+	// held after that
+	for _, t := range d.abandonHeld() {
+		d.tryEnqueue(t)
+	}
+
+	return true
+}
+
+// waitResumed blocks while the daemon is paused. It returns false if daemon
+// shutdown was requested while waiting.
+func (d *BaseDaemon) waitResumed() bool {
+	p := &d.pauseState
+	p.Lock()
+	paused, resumed := p.paused, p.resumed
+	p.Unlock()
+
+	if !paused {
+		return true
+	}
+	select {
+	case <-resumed:
+		return true
+	case <-d.shutdown:
+		return false
+	}
+}
@@ -0,0 +1,87 @@
+package shezmu
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPauseHoldsTasks(t *testing.T) {
+	q := newPriorityQueue(10)
+	d := &BaseDaemon{name: "test", queue: q}
+	t1 := &Task{daemon: d}
+	t2 := &Task{daemon: d}
+
+	if !d.acquire(t1) {
+		t.Fatal("Expected task to acquire a slot")
+	}
+	if !d.pause() {
+		t.Fatal("Expected daemon to be paused")
+	}
+	if d.pause() {
+		t.Fatal("Expected daemon to be paused only once")
+	}
+	if d.acquire(t2) {
+		t.Fatal("Expected task to be held while paused")
+	}
+	if next := d.release(); next != nil {
+		t.Fatal("Expected held task not to be released while paused")
+	}
+
+	select {
+	case <-d.PauseRequested():
+	default:
+		t.Fatal("Expected pause to be requested")
+	}
+	done := make(chan bool)
+	go func() {
+		done <- d.Continue()
+	}()
+	select {
+	case <-done:
+		t.Fatal("Expected Continue to block while paused")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	if !d.resume() {
+		t.Fatal("Expected daemon to be resumed")
+	}
+	if !<-done {
+		t.Error("Expected Continue to return true after resume")
+	}
+	if n := q.Len(); n != 1 {
+		t.Fatalf("Expected held task to be queued again, got %d queued tasks", n)
+	}
+	if qt, _ := q.Pop(); qt != t2 {
+		t.Error("Expected held task to be queued")
+	}
+	select {
+	case <-d.PauseRequested():
+		t.Error("Expected pause not to be requested after resume")
+	default:
+	}
+}
+
+func TestStopPausedDaemon(t *testing.T) {
+	d := &testDaemon{BaseDaemon{name: "test"}}
+	s := newTestShezmu(d)
+	s.NumWorkers = 1
+	s.StartDaemons()
+
+	block := make(chan struct{})
+	d.Process(func() { <-block })
+	var ran int
+	for i := 0; i < 3; i++ {
+		d.Process(func() { ran++ })
+	}
+	s.PauseDaemon("test")
+	close(block)
+	// Wait for the worker to take queued tasks and hold them
+	for s.mainPool().queue.Len() > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	s.StopDaemons()
+
+	if ran != 3 {
+		t.Errorf("Expected held tasks to be processed on stop, %d of 3 ran", ran)
+	}
+}
@@ -0,0 +1,51 @@
+package shezmu
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// pool is a set of workers that process tasks from a queue. All daemons share
+// the main pool unless they are set up to use a dedicated one.
+type pool struct {
+	queue   Queue
+	wg      sync.WaitGroup
+	workers int64
+	busy    int64
+}
+
+func newPool(q Queue) *pool {
+	return &pool{queue: q}
+}
+
+// startWorkers adds n workers to the pool.
+func (s *Shezmu) startWorkers(p *pool, n int) {
+	for i := 0; i < n; i++ {
+		p.wg.Add(1)
+		go s.runWorker(p)
+	}
+}
+
+// retireWorker makes one of the pool workers exit after it finishes its
+// current task.
+func (p *pool) retireWorker() {
+	p.queue.Push(&Task{
+		createdAt: time.Now(),
+		system:    true,
+		retire:    true,
+		priority:  PriorityCritical,
+		name:      "retire",
+	}, OverflowBlock)
+}
+
+// size returns the number of running workers.
+func (p *pool) size() int {
+	return int(atomic.LoadInt64(&p.workers))
+}
+
+// idle returns true if some of the workers are not busy and there are no tasks
+// waiting in the queue.
+func (p *pool) idle() bool {
+	return atomic.LoadInt64(&p.busy) < atomic.LoadInt64(&p.workers) && p.queue.Len() == 0
+}
@@ -0,0 +1,368 @@
+package shezmu
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Priority defines the order in which queued tasks are processed. Tasks with
+// higher priority are always taken first, except that every
+// starvationLimit-th task is taken from the lowest priority level if it has
+// tasks waiting.
+type Priority int
+
+const (
+	// PriorityLow is the priority for tasks that could wait.
+	PriorityLow Priority = iota - 1
+	// PriorityNormal is the default priority.
+	PriorityNormal
+	// PriorityHigh is the priority for important tasks.
+	PriorityHigh
+	// PriorityCritical is the priority for tasks that should be processed
+	// before anything else. System tasks use this priority.
+	PriorityCritical
+
+	numPriorities = int(PriorityCritical-PriorityLow) + 1
+)
+
+const (
+	// starvationLimit is the number of tasks taken from higher priority levels
+	// after which a task from the lowest level is taken.
+	starvationLimit = 10
+)
+
+// OverflowPolicy defines what happens when a daemon adds a task to a queue that
+// is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock makes Process wait until there is free space in the queue.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest drops the task that is being added.
+	OverflowDropNewest
+	// OverflowDropOldest drops the oldest queued task of the same daemon to
+	// make space for the new one. If the daemon has no queued tasks the new
+	// task is dropped instead.
+	OverflowDropOldest
+
+	// OverflowReject makes Push return ErrQueueFull. TryProcess always uses
+	// this policy.
+	OverflowReject
+)
+
+var (
+	// ErrQueueFull is returned by TryProcess when the task queue is full.
+	ErrQueueFull = errors.New("task queue is full")
+	// ErrQueueClosed is returned by TryProcess when daemons are not running.
+	ErrQueueClosed = errors.New("task queue is closed")
+)
+
+// Queue is the interface of a task queue shared by workers of a pool.
+// Implementations must be safe for concurrent use. System tasks must never be
+// dropped and must not be limited by queue capacity. Tasks carry closures, so
+// only durable tasks could be written to disk, see NewDiskQueue.
+//
+// Built-in queues implement optional capabilities that are not available to
+// other implementations: tasks that wait for a daemon concurrency slot count
+// towards their capacity, the elastic pool scales up when the oldest queued
+// task waits too long even if workers report no latency, and remaining tasks
+// are taken at once when the shutdown deadline is reached. Other queues are
+// drained with Close and Pop at the deadline instead.
+type Queue interface {
+	// Push adds a task to the queue applying given overflow policy. It returns
+	// a task that was dropped in order to respect queue capacity, if any.
+	// ErrQueueFull is returned if the queue is full and the policy is
+	// OverflowReject, ErrQueueClosed is returned if the queue is closed.
+	Push(t *Task, p OverflowPolicy) (dropped *Task, err error)
+	// Pop takes the next task from the queue waiting for one if necessary.
+	// Once the queue is closed it continues to return queued tasks and then
+	// returns false.
+	Pop() (*Task, bool)
+	// Len returns the number of queued tasks.
+	Len() int
+	// Close makes all pending and future Push calls fail.
+	Close()
+}
+
+// QueueFactory is a function that creates a queue with given capacity. Zero or
+// negative capacity makes the queue unbounded.
+type QueueFactory func(capacity int) Queue
+
+// Optional queue capabilities that built-in queues implement.
+type (
+	// holder counts tasks that were taken from the queue but are waiting for
+	// a daemon concurrency slot towards queue capacity.
+	holder interface {
+		hold(n int)
+	}
+	// waiter reports for how long the oldest queued task has been waiting.
+	waiter interface {
+		wait() time.Duration
+	}
+	// abandoner closes the queue and returns all tasks that remained in it.
+	abandoner interface {
+		abandon() []*Task
+	}
+)
+
+// abandonQueue closes a queue and returns all tasks that remained in it.
+func abandonQueue(q Queue) []*Task {
+	if a, ok := q.(abandoner); ok {
+		return a.abandon()
+	}
+
+	q.Close()
+	var tasks []*Task
+	for {
+		t, ok := q.Pop()
+		if !ok {
+			return tasks
+		}
+		tasks = append(tasks, t)
+	}
+}
+
+// queueWait returns for how long the oldest task in a queue has been waiting
+// if the queue supports it.
+func queueWait(q Queue) time.Duration {
+	if w, ok := q.(waiter); ok {
+		return w.wait()
+	}
+
+	return 0
+}
+
+// priorityQueue is a bounded priority queue of tasks. Tasks of the same
+// priority are processed in FIFO order.
+type priorityQueue struct {
+	sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	levels   [numPriorities]*list.List
+	size     int
+	held     int
+	capacity int
+	skipped  int
+	draining bool
+	closed   bool
+}
+
+// NewPriorityQueue creates a queue that processes tasks in the order of their
+// priority. It is the default queue.
+func NewPriorityQueue(capacity int) Queue {
+	return newPriorityQueue(capacity)
+}
+
+func newPriorityQueue(capacity int) *priorityQueue {
+	q := &priorityQueue{capacity: capacity}
+	for i := range q.levels {
+		q.levels[i] = list.New()
+	}
+	q.notEmpty = sync.NewCond(q)
+	q.notFull = sync.NewCond(q)
+
+	return q
+}
+
+// Push adds a task to the queue applying given overflow policy.
+func (q *priorityQueue) Push(t *Task, p OverflowPolicy) (dropped *Task, err error) {
+	q.Lock()
+	defer q.Unlock()
+
+	// Exactly one task is dropped to make space for a new one, even if system
+	// tasks keep the queue over capacity
+	for dropped == nil && !q.closed && !q.draining && !t.system && q.full() {
+		switch p {
+		case OverflowBlock:
+			q.notFull.Wait()
+			continue
+		case OverflowDropNewest:
+			return t, nil
+		case OverflowDropOldest:
+			if dropped = q.removeOldest(t.daemon); dropped == nil {
+				return t, nil
+			}
+		default:
+			return nil, ErrQueueFull
+		}
+	}
+	if q.closed || q.draining {
+		return nil, ErrQueueClosed
+	}
+
+	t.queue = q
+	q.level(t.priority).PushBack(t)
+	q.size++
+	q.notEmpty.Signal()
+
+	return dropped, nil
+}
+
+// Pop takes the next task from the queue waiting for one if necessary.
+func (q *priorityQueue) Pop() (*Task, bool) {
+	q.Lock()
+	defer q.Unlock()
+
+	for !q.closed && !q.draining && q.size == 0 {
+		q.notEmpty.Wait()
+	}
+	if q.closed || q.size == 0 {
+		return nil, false
+	}
+
+	t := q.next()
+	q.size--
+	q.notFull.Signal()
+
+	return t, true
+}
+
+// tryPop takes the next task from the queue if there is one.
+func (q *priorityQueue) tryPop() (*Task, bool) {
+	q.Lock()
+	defer q.Unlock()
+
+	if q.closed || q.size == 0 {
+		return nil, false
+	}
+
+	t := q.next()
+	q.size--
+	q.notFull.Signal()
+
+	return t, true
+}
+
+// Len returns the number of queued tasks.
+func (q *priorityQueue) Len() int {
+	q.Lock()
+	defer q.Unlock()
+
+	return q.size
+}
+
+// next removes and returns the task with the highest priority. Queue must not
+// be empty.
+func (q *priorityQueue) next() *Task {
+	lowest := q.levels[0]
+	for i := len(q.levels) - 1; i > 0; i-- {
+		if l := q.levels[i]; l.Len() > 0 {
+			if lowest.Len() == 0 {
+				return l.Remove(l.Front()).(*Task)
+			}
+			if q.skipped < starvationLimit {
+				q.skipped++
+				return l.Remove(l.Front()).(*Task)
+			}
+			break
+		}
+	}
+
+	q.skipped = 0
+	return lowest.Remove(lowest.Front()).(*Task)
+}
+
+func (q *priorityQueue) level(p Priority) *list.List {
+	switch {
+	case p < PriorityLow:
+		p = PriorityLow
+	case p > PriorityCritical:
+		p = PriorityCritical
+	}
+
+	return q.levels[p-PriorityLow]
+}
+
+// hold adjusts the number of tasks that were taken from the queue but are
+// waiting for a daemon concurrency slot. Such tasks count towards queue
+// capacity.
+func (q *priorityQueue) hold(n int) {
+	q.Lock()
+	defer q.Unlock()
+
+	q.held += n
+	if n < 0 {
+		q.notFull.Signal()
+	}
+}
+
+// wait returns for how long the oldest queued task has been waiting.
+func (q *priorityQueue) wait() time.Duration {
+	q.Lock()
+	defer q.Unlock()
+
+	var oldest time.Time
+	for _, l := range q.levels {
+		if e := l.Front(); e != nil {
+			if t := e.Value.(*Task); oldest.IsZero() || t.createdAt.Before(oldest) {
+				oldest = t.createdAt
+			}
+		}
+	}
+	if oldest.IsZero() {
+		return 0
+	}
+
+	return time.Now().Sub(oldest)
+}
+
+// Close makes all pending and future push calls fail while pop calls continue
+// to return queued tasks until the queue is empty.
+func (q *priorityQueue) Close() {
+	q.Lock()
+	defer q.Unlock()
+
+	q.draining = true
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+}
+
+// abandon closes the queue and returns all tasks that remained in it.
+func (q *priorityQueue) abandon() []*Task {
+	q.Lock()
+	defer q.Unlock()
+
+	var tasks []*Task
+	for _, l := range q.levels {
+		for e := l.Front(); e != nil; e = e.Next() {
+			tasks = append(tasks, e.Value.(*Task))
+		}
+		l.Init()
+	}
+	q.size = 0
+	q.closed = true
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+
+	return tasks
+}
+
+func (q *priorityQueue) full() bool {
+	return q.capacity > 0 && q.size+q.held >= q.capacity
+}
+
+// removeOldest removes the oldest general task of the given daemon. Tasks are
+// ordered by creation time within each level, so only the first match of each
+// level is considered.
+func (q *priorityQueue) removeOldest(d Daemon) *Task {
+	var oldest *list.Element
+	var level *list.List
+	for _, l := range q.levels {
+		for e := l.Front(); e != nil; e = e.Next() {
+			if t := e.Value.(*Task); t.daemon == d && !t.system {
+				if oldest == nil || t.createdAt.Before(oldest.Value.(*Task).createdAt) {
+					oldest, level = e, l
+				}
+				break
+			}
+		}
+	}
+	if oldest == nil {
+		return nil
+	}
+
+	q.size--
+	return level.Remove(oldest).(*Task)
+}
@@ -0,0 +1,126 @@
+package shezmu
+
+import (
+	"testing"
+)
+
+func TestQueueDropNewest(t *testing.T) {
+	q := newPriorityQueue(1)
+	d := &BaseDaemon{}
+	t1, t2 := &Task{daemon: d}, &Task{daemon: d}
+
+	if dropped, err := q.Push(t1, OverflowDropNewest); dropped != nil || err != nil {
+		t.Fatalf("Expected task to be added, got dropped=%v err=%v", dropped, err)
+	}
+	if dropped, _ := q.Push(t2, OverflowDropNewest); dropped != t2 {
+		t.Errorf("Expected the new task to be dropped, got %v", dropped)
+	}
+	if l := q.Len(); l != 1 {
+		t.Errorf("Expected queue length to be 1, got %d", l)
+	}
+}
+
+func TestQueueDropOldest(t *testing.T) {
+	q := newPriorityQueue(2)
+	d1, d2 := &BaseDaemon{}, &BaseDaemon{}
+	t1, t2, t3 := &Task{daemon: d1}, &Task{daemon: d2}, &Task{daemon: d2}
+
+	q.Push(t1, OverflowDropOldest)
+	q.Push(t2, OverflowDropOldest)
+	if dropped, _ := q.Push(t3, OverflowDropOldest); dropped != t2 {
+		t.Errorf("Expected the oldest task of the same daemon to be dropped, got %v", dropped)
+	}
+	if dropped, _ := q.Push(&Task{daemon: &BaseDaemon{}}, OverflowDropOldest); dropped == nil {
+		t.Error("Expected the new task to be dropped")
+	}
+	if next, _ := q.Pop(); next != t1 {
+		t.Errorf("Expected tasks of other daemons to remain intact")
+	}
+}
+
+func TestQueueDropOldestOverCapacity(t *testing.T) {
+	q := newPriorityQueue(2)
+	d := &BaseDaemon{}
+	t1, t2 := &Task{daemon: d}, &Task{daemon: d}
+
+	q.Push(t1, OverflowDropOldest)
+	q.Push(t2, OverflowDropOldest)
+	q.Push(&Task{daemon: d, system: true}, OverflowDropOldest)
+	// The queue stays over capacity, but only one task is dropped per push
+	if dropped, _ := q.Push(&Task{daemon: d}, OverflowDropOldest); dropped != t1 {
+		t.Errorf("Expected the oldest task to be dropped, got %v", dropped)
+	}
+	if l := q.Len(); l != 3 {
+		t.Errorf("Expected queue length to be 3, got %d", l)
+	}
+}
+
+func TestQueueReject(t *testing.T) {
+	q := newPriorityQueue(1)
+	q.Push(&Task{}, OverflowReject)
+	if _, err := q.Push(&Task{}, OverflowReject); err != ErrQueueFull {
+		t.Errorf("Expected ErrQueueFull, got %v", err)
+	}
+	if _, err := q.Push(&Task{system: true}, OverflowReject); err != nil {
+		t.Errorf("Expected system task to bypass capacity, got %v", err)
+	}
+
+	q.abandon()
+	if _, err := q.Push(&Task{}, OverflowBlock); err != ErrQueueClosed {
+		t.Errorf("Expected ErrQueueClosed, got %v", err)
+	}
+	if _, ok := q.Pop(); ok {
+		t.Error("Expected pop to fail on a closed queue")
+	}
+}
+
+func TestQueuePriority(t *testing.T) {
+	q := newPriorityQueue(0)
+	low := &Task{priority: PriorityLow}
+	normal := &Task{priority: PriorityNormal}
+	high := &Task{priority: PriorityHigh}
+	q.Push(low, OverflowBlock)
+	q.Push(normal, OverflowBlock)
+	q.Push(high, OverflowBlock)
+
+	for _, exp := range []*Task{high, normal, low} {
+		if next, _ := q.Pop(); next != exp {
+			t.Errorf("Expected task with priority %d, got %d", exp.priority, next.priority)
+		}
+	}
+}
+
+func TestQueueStarvation(t *testing.T) {
+	q := newPriorityQueue(0)
+	low := &Task{priority: PriorityLow}
+	q.Push(low, OverflowBlock)
+	for i := 0; i < 2*starvationLimit; i++ {
+		q.Push(&Task{priority: PriorityHigh}, OverflowBlock)
+	}
+
+	for i := 0; i < starvationLimit; i++ {
+		if next, _ := q.Pop(); next == low {
+			t.Fatalf("Expected low priority task to wait, got it after %d tasks", i)
+		}
+	}
+	if next, _ := q.Pop(); next != low {
+		t.Errorf("Expected low priority task after %d high priority ones", starvationLimit)
+	}
+}
+
+func TestQueueDrain(t *testing.T) {
+	q := newPriorityQueue(0)
+	t1 := &Task{}
+	q.Push(t1, OverflowBlock)
+
+	q.Close()
+	if _, err := q.Push(&Task{}, OverflowBlock); err != ErrQueueClosed {
+		t.Errorf("Expected ErrQueueClosed, got %v", err)
+	}
+	if next, ok := q.Pop(); !ok || next != t1 {
+		t.Error("Expected queued task to be returned after drain")
+	}
+	if _, ok := q.Pop(); ok {
+		t.Error("Expected pop to fail on a drained queue")
+	}
+}
@@ -0,0 +1,116 @@
+package shezmu
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// RestartPolicy defines how crashed system tasks are restarted. Restart delay
+// grows exponentially with every consecutive crash of a task. A task that runs
+// for longer than MaxDelay before crashing is considered recovered and its
+// delay is reset.
+type RestartPolicy struct {
+	// InitialDelay is the delay before the first restart.
+	InitialDelay time.Duration
+	// Multiplier is the factor the delay is multiplied by on every consecutive
+	// restart. Values less than 1 are treated as 1.
+	Multiplier float64
+	// MaxDelay is the upper limit of the restart delay.
+	MaxDelay time.Duration
+	// Jitter is the fraction of the delay that is randomly added or subtracted
+	// from it, a number between 0 and 1.
+	Jitter float64
+	// MaxRestarts is the maximum number of daemon system task restarts within
+	// Window. When the budget is exhausted the daemon is marked as failed.
+	// Zero value means there is no limit.
+	MaxRestarts int
+	// Window is the time frame within which restarts are counted.
+	Window time.Duration
+}
+
+// FailureHandler is a function that is called when a daemon fails.
+type FailureHandler func(error)
+
+// DefaultRestartPolicy is the restart policy used by default.
+var DefaultRestartPolicy = RestartPolicy{
+	InitialDelay: 100 * time.Millisecond,
+	Multiplier:   2,
+	MaxDelay:     30 * time.Second,
+	Jitter:       0.2,
+}
+
+// delay returns the delay before the given restart attempt, starting with 0.
+func (p RestartPolicy) delay(attempt int) time.Duration {
+	return backoff(p.InitialDelay, p.Multiplier, p.MaxDelay, p.Jitter, attempt)
+}
+
+// backoff returns an exponentially growing delay before the given attempt,
+// starting with 0.
+func backoff(initial time.Duration, multiplier float64, max time.Duration, jitter float64, attempt int) time.Duration {
+	mult := math.Max(multiplier, 1)
+	dur := float64(initial) * math.Pow(mult, float64(attempt))
+	if max > 0 && dur > float64(max) {
+		dur = float64(max)
+	}
+	if jitter > 0 {
+		dur += dur * jitter * (2*rand.Float64() - 1)
+	}
+
+	return time.Duration(dur)
+}
+
+// restartBudget keeps track of restarts within a restart policy window.
+type restartBudget struct {
+	sync.Mutex
+	times []time.Time
+}
+
+// allow registers a restart and returns false if restart budget is exhausted.
+func (b *restartBudget) allow(p RestartPolicy) bool {
+	if p.MaxRestarts <= 0 {
+		return true
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	now := time.Now()
+	recent := b.times[:0]
+	for _, ts := range b.times {
+		if p.Window <= 0 || now.Sub(ts) < p.Window {
+			recent = append(recent, ts)
+		}
+	}
+	b.times = recent
+	if len(b.times) >= p.MaxRestarts {
+		return false
+	}
+	b.times = append(b.times, now)
+
+	return true
+}
+
+func (b *restartBudget) reset() {
+	b.Lock()
+	b.times = nil
+	b.Unlock()
+}
+
+// fail marks the daemon as failed and calls its failure handler.
+func (d *BaseDaemon) fail(err error) {
+	d.lifecycle.Lock()
+	d.lifecycle.failed = true
+	e, ok := d.transition(StateFailed, err)
+	d.lifecycle.Unlock()
+	d.markCrashLoop(err, 0)
+
+	if ok {
+		d.emit(e)
+	}
+
+	if d.failureHandler != nil {
+		d.failureHandler(err)
+	}
+}
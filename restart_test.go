@@ -0,0 +1,93 @@
+package shezmu
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRestartPolicyDelay(t *testing.T) {
+	p := RestartPolicy{
+		InitialDelay: time.Second,
+		Multiplier:   2,
+		MaxDelay:     5 * time.Second,
+	}
+
+	for i, exp := range []time.Duration{1, 2, 4, 5, 5} {
+		if d := p.delay(i); d != exp*time.Second {
+			t.Errorf("Expected attempt %d delay to be %s, got %s", i, exp*time.Second, d)
+		}
+	}
+}
+
+func TestRestartPolicyJitter(t *testing.T) {
+	p := RestartPolicy{
+		InitialDelay: time.Second,
+		Jitter:       0.5,
+	}
+
+	for i := 0; i < 100; i++ {
+		if d := p.delay(0); d < 500*time.Millisecond || d > 1500*time.Millisecond {
+			t.Fatalf("Expected delay to be within 50%% of a second, got %s", d)
+		}
+	}
+}
+
+func TestRestartBudget(t *testing.T) {
+	p := RestartPolicy{
+		MaxRestarts: 2,
+		Window:      time.Hour,
+	}
+	b := &restartBudget{}
+
+	for i := 0; i < 2; i++ {
+		if !b.allow(p) {
+			t.Fatalf("Expected restart %d to be allowed", i+1)
+		}
+	}
+	if b.allow(p) {
+		t.Error("Expected restart budget to be exhausted")
+	}
+}
+
+func TestCrashLoopFails(t *testing.T) {
+	d := &testDaemon{BaseDaemon{name: "test"}}
+	d.SetRestartPolicy(RestartPolicy{
+		InitialDelay: time.Millisecond,
+		MaxRestarts:  2,
+		Window:       time.Minute,
+	})
+	failed := make(chan error, 1)
+	d.HandleFailure(func(err error) { failed <- err })
+	s := newTestShezmu(d)
+	s.StartDaemons()
+	defer s.StopDaemons()
+	waitStarted(d)
+
+	var runs int64
+	errCrash := errors.New("crash")
+	d.SystemProcessContext("crash", func(context.Context) error {
+		atomic.AddInt64(&runs, 1)
+		return errCrash
+	})
+	select {
+	case err := <-failed:
+		if err != errCrash {
+			t.Errorf("Expected failure handler to receive the crash error, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected failure handler to be called")
+	}
+
+	if !d.Failed() || d.State() != StateFailed {
+		t.Errorf("Expected daemon to be failed, got %s", d.State())
+	}
+	if n := atomic.LoadInt64(&runs); n != 3 {
+		t.Errorf("Expected system task to run 3 times, ran %d times", n)
+	}
+	if r := s.Health(); r.Live {
+		t.Error("Expected health report not to be live after the daemon failed")
+	}
+}
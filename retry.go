@@ -0,0 +1,83 @@
+package shezmu
+
+import (
+	"time"
+
+	"github.com/localhots/shezmu/stats"
+)
+
+// RetryPolicy defines how failed tasks are retried. A task fails when its
+// actor returns an error or panics, in which case the error is a *PanicError.
+// Delay between attempts grows exponentially.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts including the first one.
+	MaxAttempts int
+	// InitialDelay is the delay before the first retry.
+	InitialDelay time.Duration
+	// Multiplier is the factor the delay is multiplied by on every consecutive
+	// retry. Values less than 1 are treated as 1.
+	Multiplier float64
+	// MaxDelay is the upper limit of the retry delay.
+	MaxDelay time.Duration
+	// Jitter is the fraction of the delay that is randomly added or subtracted
+	// from it, a number between 0 and 1.
+	Jitter float64
+	// Retryable decides whether a task that failed with given error should be
+	// retried. All errors are retryable if it is nil.
+	Retryable func(error) bool
+}
+
+// WithRetry overrides the daemon retry policy for a single task.
+func WithRetry(p RetryPolicy) TaskOption {
+	return func(t *Task) {
+		t.retry = &p
+	}
+}
+
+// SetRetryPolicy sets the retry policy for daemon tasks. Tasks are not retried
+// by default.
+func (d *BaseDaemon) SetRetryPolicy(p RetryPolicy) {
+	d.retry = &p
+}
+
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	return backoff(p.InitialDelay, p.Multiplier, p.MaxDelay, p.Jitter, attempt)
+}
+
+// allow returns true if a task that failed on given attempt, starting with 0,
+// should be retried.
+func (p RetryPolicy) allow(attempt int, err error) bool {
+	if attempt+1 >= p.MaxAttempts {
+		return false
+	}
+
+	return p.Retryable == nil || p.Retryable(err)
+}
+
+// retryTask schedules another attempt of a failed task if its retry policy
+// allows it. It returns false if the task should not be retried.
+func (s *Shezmu) retryTask(t *Task, err error) bool {
+	if t.retry == nil || !t.retry.allow(t.attempt, err) || !t.daemon.base().isRunning() {
+		return false
+	}
+	// Delayed tasks are not processed during shutdown
+	s.mu.Lock()
+	running := s.running
+	s.mu.Unlock()
+	if !running {
+		return false
+	}
+
+	// Another attempt is a copy of the task, so that it could be tracked
+	// separately from the one that is finishing
+	next := *t
+	next.attempt++
+	next.lastErr = err
+	delay := t.retry.delay(t.attempt)
+	stats.Retry(s.DaemonStats, t.daemon.String())
+	s.Logger.Log(LevelWarn, "Task failed, retrying", t.fields(
+		F("error", err), F("delay", delay), F("next_attempt", next.attempt+1), F("max_attempts", t.retry.MaxAttempts))...)
+	s.timers.add(&next, time.Now().Add(delay))
+
+	return true
+}
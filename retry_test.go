@@ -0,0 +1,60 @@
+package shezmu
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/localhots/shezmu/stats"
+)
+
+func TestRetryPolicyAllow(t *testing.T) {
+	temporary := errors.New("temporary")
+	p := RetryPolicy{
+		MaxAttempts: 3,
+		Retryable: func(err error) bool {
+			return err == temporary
+		},
+	}
+
+	for attempt, exp := range []bool{true, true, false} {
+		if ok := p.allow(attempt, temporary); ok != exp {
+			t.Errorf("Expected attempt %d retry to be %t, got %t", attempt, exp, ok)
+		}
+	}
+	if p.allow(0, errors.New("permanent")) {
+		t.Error("Expected permanent error not to be retried")
+	}
+}
+
+func TestRetry(t *testing.T) {
+	d := &testDaemon{BaseDaemon{name: "test"}}
+	d.SetRetryPolicy(RetryPolicy{
+		MaxAttempts:  3,
+		InitialDelay: time.Millisecond,
+	})
+	s := newTestShezmu(d)
+	st := stats.NewBasicStats()
+	s.DaemonStats = st
+	s.StartDaemons()
+	defer s.StopDaemons()
+	waitStarted(d)
+
+	var attempts int64
+	f := d.Submit(func() (interface{}, error) {
+		if atomic.AddInt64(&attempts, 1) < 3 {
+			return nil, errors.New("temporary")
+		}
+		return 42, nil
+	})
+	if val, err := f.Wait(); val != 42 || err != nil {
+		t.Errorf("Expected future to be resolved with 42 after retries, got %v, %v", val, err)
+	}
+	if n := atomic.LoadInt64(&attempts); n != 3 {
+		t.Errorf("Expected 3 attempts, got %d", n)
+	}
+	if n := st.Fetch("test").Retried(); n != 2 {
+		t.Errorf("Expected 2 retries to be recorded, got %d", n)
+	}
+}
@@ -0,0 +1,193 @@
+package shezmu
+
+import (
+	"sync"
+	"time"
+)
+
+// ringQueue is a FIFO queue of tasks backed by a ring buffer. It ignores task
+// priorities which makes it cheaper than the priority queue. System tasks are
+// not limited by queue capacity, the buffer grows to fit them.
+type ringQueue struct {
+	sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	buf      []*Task
+	head     int
+	size     int
+	held     int
+	capacity int
+	draining bool
+	closed   bool
+}
+
+// NewRingQueue creates a FIFO queue that ignores task priorities.
+func NewRingQueue(capacity int) Queue {
+	return newRingQueue(capacity)
+}
+
+func newRingQueue(capacity int) *ringQueue {
+	n := capacity
+	if n <= 0 {
+		n = 16
+	}
+	q := &ringQueue{
+		buf:      make([]*Task, n),
+		capacity: capacity,
+	}
+	q.notEmpty = sync.NewCond(q)
+	q.notFull = sync.NewCond(q)
+
+	return q
+}
+
+// Push adds a task to the queue applying given overflow policy.
+func (q *ringQueue) Push(t *Task, p OverflowPolicy) (dropped *Task, err error) {
+	q.Lock()
+	defer q.Unlock()
+
+	// Exactly one task is dropped to make space for a new one, even if system
+	// tasks keep the queue over capacity
+	for dropped == nil && !q.closed && !q.draining && !t.system && q.full() {
+		switch p {
+		case OverflowBlock:
+			q.notFull.Wait()
+			continue
+		case OverflowDropNewest:
+			return t, nil
+		case OverflowDropOldest:
+			if dropped = q.removeOldest(t.daemon); dropped == nil {
+				return t, nil
+			}
+		default:
+			return nil, ErrQueueFull
+		}
+	}
+	if q.closed || q.draining {
+		return nil, ErrQueueClosed
+	}
+
+	if q.size == len(q.buf) {
+		q.grow()
+	}
+	t.queue = q
+	q.buf[(q.head+q.size)%len(q.buf)] = t
+	q.size++
+	q.notEmpty.Signal()
+
+	return dropped, nil
+}
+
+// Pop takes the next task from the queue waiting for one if necessary.
+func (q *ringQueue) Pop() (*Task, bool) {
+	q.Lock()
+	defer q.Unlock()
+
+	for !q.closed && !q.draining && q.size == 0 {
+		q.notEmpty.Wait()
+	}
+	if q.closed || q.size == 0 {
+		return nil, false
+	}
+
+	t := q.buf[q.head]
+	q.buf[q.head] = nil
+	q.head = (q.head + 1) % len(q.buf)
+	q.size--
+	q.notFull.Signal()
+
+	return t, true
+}
+
+// Len returns the number of queued tasks.
+func (q *ringQueue) Len() int {
+	q.Lock()
+	defer q.Unlock()
+
+	return q.size
+}
+
+// Close makes all pending and future push calls fail while pop calls continue
+// to return queued tasks until the queue is empty.
+func (q *ringQueue) Close() {
+	q.Lock()
+	defer q.Unlock()
+
+	q.draining = true
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+}
+
+func (q *ringQueue) hold(n int) {
+	q.Lock()
+	defer q.Unlock()
+
+	q.held += n
+	if n < 0 {
+		q.notFull.Signal()
+	}
+}
+
+func (q *ringQueue) wait() time.Duration {
+	q.Lock()
+	defer q.Unlock()
+
+	if q.size == 0 {
+		return 0
+	}
+
+	return time.Now().Sub(q.buf[q.head].createdAt)
+}
+
+func (q *ringQueue) abandon() []*Task {
+	q.Lock()
+	defer q.Unlock()
+
+	tasks := make([]*Task, 0, q.size)
+	for i := 0; i < q.size; i++ {
+		j := (q.head + i) % len(q.buf)
+		tasks = append(tasks, q.buf[j])
+		q.buf[j] = nil
+	}
+	q.head, q.size = 0, 0
+	q.closed = true
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+
+	return tasks
+}
+
+func (q *ringQueue) full() bool {
+	return q.capacity > 0 && q.size+q.held >= q.capacity
+}
+
+// grow doubles the size of the buffer.
+func (q *ringQueue) grow() {
+	buf := make([]*Task, 2*len(q.buf))
+	for i := 0; i < q.size; i++ {
+		buf[i] = q.buf[(q.head+i)%len(q.buf)]
+	}
+	q.buf = buf
+	q.head = 0
+}
+
+// removeOldest removes the oldest general task of the given daemon.
+func (q *ringQueue) removeOldest(d Daemon) *Task {
+	for i := 0; i < q.size; i++ {
+		t := q.buf[(q.head+i)%len(q.buf)]
+		if t.daemon != d || t.system {
+			continue
+		}
+
+		// Shift the tasks that follow to close the gap
+		for j := i; j < q.size-1; j++ {
+			q.buf[(q.head+j)%len(q.buf)] = q.buf[(q.head+j+1)%len(q.buf)]
+		}
+		q.buf[(q.head+q.size-1)%len(q.buf)] = nil
+		q.size--
+
+		return t
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package shezmu
+
+import (
+	"testing"
+)
+
+func TestRingQueueOrder(t *testing.T) {
+	q := newRingQueue(2)
+	t1, t2 := &Task{priority: PriorityLow}, &Task{priority: PriorityHigh}
+
+	q.Push(t1, OverflowBlock)
+	q.Push(t2, OverflowBlock)
+	if _, err := q.Push(&Task{}, OverflowReject); err != ErrQueueFull {
+		t.Errorf("Expected ErrQueueFull, got %v", err)
+	}
+	// System tasks make the buffer grow
+	if _, err := q.Push(&Task{system: true}, OverflowReject); err != nil {
+		t.Errorf("Expected system task to bypass capacity, got %v", err)
+	}
+	for i, exp := range []*Task{t1, t2} {
+		if next, _ := q.Pop(); next != exp {
+			t.Errorf("Expected task #%d to be taken in FIFO order", i)
+		}
+	}
+	if l := q.Len(); l != 1 {
+		t.Errorf("Expected queue length to be 1, got %d", l)
+	}
+}
+
+func TestRingQueueDropOldest(t *testing.T) {
+	q := newRingQueue(3)
+	d1, d2 := &BaseDaemon{}, &BaseDaemon{}
+	t1, t2, t3 := &Task{daemon: d1}, &Task{daemon: d2}, &Task{daemon: d1}
+
+	q.Push(t1, OverflowDropOldest)
+	q.Push(t2, OverflowDropOldest)
+	q.Push(t3, OverflowDropOldest)
+	if dropped, _ := q.Push(&Task{daemon: d2}, OverflowDropOldest); dropped != t2 {
+		t.Errorf("Expected the oldest task of the same daemon to be dropped, got %v", dropped)
+	}
+	for i, exp := range []*Task{t1, t3} {
+		if next, _ := q.Pop(); next != exp {
+			t.Errorf("Expected task #%d to remain in order", i)
+		}
+	}
+}
+
+func TestRingQueueDropOldestOverCapacity(t *testing.T) {
+	q := newRingQueue(2)
+	d := &BaseDaemon{}
+	t1, t2 := &Task{daemon: d}, &Task{daemon: d}
+
+	q.Push(t1, OverflowDropOldest)
+	q.Push(t2, OverflowDropOldest)
+	q.Push(&Task{daemon: d, system: true}, OverflowDropOldest)
+	if dropped, _ := q.Push(&Task{daemon: d}, OverflowDropOldest); dropped != t1 {
+		t.Errorf("Expected the oldest task to be dropped, got %v", dropped)
+	}
+	if l := q.Len(); l != 3 {
+		t.Errorf("Expected queue length to be 3, got %d", l)
+	}
+}
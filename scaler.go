@@ -0,0 +1,91 @@
+package shezmu
+
+import (
+	"time"
+
+	"github.com/localhots/shezmu/stats"
+)
+
+const (
+	// DefaultScaleUpLatency is the default task wait latency that makes an
+	// elastic worker pool grow.
+	DefaultScaleUpLatency = 100 * time.Millisecond
+	// DefaultScaleDownIdle is the default period of idleness after which an
+	// elastic worker pool shrinks.
+	DefaultScaleDownIdle = time.Minute
+)
+
+// elastic returns true if the worker pool should scale with load.
+func (s *Shezmu) elastic() bool {
+	return s.MaxWorkers > 0 && s.MaxWorkers > s.MinWorkers
+}
+
+// initialWorkers returns the number of workers to start with.
+func (s *Shezmu) initialWorkers() int {
+	if !s.elastic() {
+		return s.NumWorkers
+	}
+	if s.MinWorkers < 1 {
+		return 1
+	}
+
+	return s.MinWorkers
+}
+
+// reportLatency notifies the scaler if task wait latency is too high.
+func (s *Shezmu) reportLatency(dur time.Duration) {
+	if s.elastic() && dur > s.ScaleUpLatency {
+		select {
+		case s.scaleUp <- dur:
+		default:
+		}
+	}
+}
+
+// scale adds workers when task wait latency is high and removes them when the
+// pool stays idle for too long. Besides latency reported by workers, the wait
+// time of the oldest queued task is checked periodically in case all workers
+// are occupied by long running tasks. It returns when daemons are stopped.
+func (s *Shezmu) scale(p *pool) {
+	stopped := s.stopped()
+	interval := s.ScaleUpLatency
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	grow := func(dur time.Duration) {
+		if n := p.size(); n < s.MaxWorkers {
+			s.Logger.Log(LevelInfo, "Scaling workers up", F("latency", dur), F("workers", n+1))
+			s.runtimeStats.Add(stats.ScaleUp, dur)
+			s.startWorkers(p, 1)
+		}
+	}
+
+	idleSince := time.Now()
+	for {
+		select {
+		case dur := <-s.scaleUp:
+			grow(dur)
+			idleSince = time.Now()
+		case now := <-ticker.C:
+			if wait := queueWait(p.queue); wait > s.ScaleUpLatency {
+				grow(wait)
+			}
+			if !p.idle() {
+				idleSince = now
+				continue
+			}
+			n := p.size()
+			if idle := now.Sub(idleSince); idle >= s.ScaleDownIdle && n > s.initialWorkers() {
+				s.Logger.Log(LevelInfo, "Scaling workers down", F("idle", idle), F("workers", n-1))
+				s.runtimeStats.Add(stats.ScaleDown, idle)
+				p.retireWorker()
+				idleSince = now
+			}
+		case <-stopped:
+			return
+		}
+	}
+}
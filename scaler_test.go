@@ -0,0 +1,58 @@
+package shezmu
+
+import (
+	"testing"
+	"time"
+
+	"github.com/localhots/shezmu/stats"
+)
+
+// waitWorkers waits for the main pool to reach given number of workers.
+func waitWorkers(t *testing.T, s *Shezmu, n int) {
+	deadline := time.Now().Add(time.Second)
+	for s.Workers() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected pool to have %d workers, got %d", n, s.Workers())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestElasticPool(t *testing.T) {
+	d := &testDaemon{BaseDaemon{name: "test"}}
+	s := newTestShezmu(d)
+	s.MinWorkers = 1
+	s.MaxWorkers = 3
+	s.ScaleUpLatency = 5 * time.Millisecond
+	s.ScaleDownIdle = 20 * time.Millisecond
+	s.StartDaemons()
+	defer s.StopDaemons()
+	waitWorkers(t, s, 1)
+
+	block := make(chan struct{})
+	running := make(chan struct{}, 3)
+	for i := 0; i < 3; i++ {
+		d.Process(func() {
+			running <- struct{}{}
+			<-block
+		})
+	}
+	// Every task gets a worker once the pool grows
+	for i := 0; i < 3; i++ {
+		select {
+		case <-running:
+		case <-time.After(time.Second):
+			t.Fatalf("Expected pool to scale up, %d of 3 tasks are running", i)
+		}
+	}
+	waitWorkers(t, s, 3)
+
+	close(block)
+	waitWorkers(t, s, 1)
+	if n := s.Stats(stats.ScaleUp).Processed(); n != 2 {
+		t.Errorf("Expected 2 scale up events, got %d", n)
+	}
+	if n := s.Stats(stats.ScaleDown).Processed(); n != 2 {
+		t.Errorf("Expected 2 scale down events, got %d", n)
+	}
+}
@@ -0,0 +1,158 @@
+package shezmu
+
+import (
+	"hash/fnv"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// shardedQueue spreads tasks across several priority queues by daemon, so that
+// busy daemons contend less for the same lock. Tasks of a daemon always go to
+// the same shard and keep their order. Priorities are respected within a shard
+// only, shards are taken in turns.
+type shardedQueue struct {
+	mu     sync.Mutex
+	ready  *sync.Cond
+	shards []*priorityQueue
+	count  int
+	next   int
+	closed bool
+	// abandoned is set when remaining tasks are taken from the shards
+	abandoned bool
+}
+
+// NewShardedQueue returns a factory of queues that consist of given number of
+// shards. Queue capacity is split evenly between shards.
+func NewShardedQueue(shards int) QueueFactory {
+	return func(capacity int) Queue {
+		return newShardedQueue(shards, capacity)
+	}
+}
+
+func newShardedQueue(shards, capacity int) *shardedQueue {
+	if shards < 1 {
+		shards = 1
+	}
+	if capacity > 0 {
+		capacity = (capacity + shards - 1) / shards
+	}
+
+	q := &shardedQueue{shards: make([]*priorityQueue, shards)}
+	for i := range q.shards {
+		q.shards[i] = newPriorityQueue(capacity)
+	}
+	q.ready = sync.NewCond(&q.mu)
+
+	return q
+}
+
+// Push adds a task to the shard of its daemon applying given overflow policy.
+func (q *shardedQueue) Push(t *Task, p OverflowPolicy) (dropped *Task, err error) {
+	dropped, err = q.shard(t).Push(t, p)
+	if err != nil || dropped != nil {
+		// Either the task was not added or another task was dropped to make
+		// space for it, the number of queued tasks is the same
+		return dropped, err
+	}
+
+	q.mu.Lock()
+	q.count++
+	q.ready.Signal()
+	q.mu.Unlock()
+
+	return nil, nil
+}
+
+// Pop takes the next task from one of the shards waiting for one if
+// necessary.
+func (q *shardedQueue) Pop() (*Task, bool) {
+	q.mu.Lock()
+	for !q.closed && q.count == 0 {
+		q.ready.Wait()
+	}
+	if q.count == 0 {
+		q.mu.Unlock()
+		return nil, false
+	}
+	q.count--
+	start := q.next
+	q.next = (q.next + 1) % len(q.shards)
+	q.mu.Unlock()
+
+	// Every counted task is already in one of the shards, but it could be
+	// taken by another worker that was first to check the shard
+	for {
+		for i := range q.shards {
+			if t, ok := q.shards[(start+i)%len(q.shards)].tryPop(); ok {
+				return t, true
+			}
+		}
+
+		q.mu.Lock()
+		abandoned := q.abandoned
+		q.mu.Unlock()
+		if abandoned {
+			return nil, false
+		}
+		runtime.Gosched()
+	}
+}
+
+// Len returns the number of queued tasks.
+func (q *shardedQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.count
+}
+
+// Close makes all pending and future push calls fail while pop calls continue
+// to return queued tasks until the queue is empty.
+func (q *shardedQueue) Close() {
+	for _, s := range q.shards {
+		s.Close()
+	}
+
+	q.mu.Lock()
+	q.closed = true
+	q.ready.Broadcast()
+	q.mu.Unlock()
+}
+
+func (q *shardedQueue) wait() time.Duration {
+	var max time.Duration
+	for _, s := range q.shards {
+		if w := s.wait(); w > max {
+			max = w
+		}
+	}
+
+	return max
+}
+
+func (q *shardedQueue) abandon() []*Task {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var tasks []*Task
+	for _, s := range q.shards {
+		tasks = append(tasks, s.abandon()...)
+	}
+	q.count = 0
+	q.closed = true
+	q.abandoned = true
+	q.ready.Broadcast()
+
+	return tasks
+}
+
+func (q *shardedQueue) shard(t *Task) *priorityQueue {
+	if t.daemon == nil || len(q.shards) == 1 {
+		return q.shards[0]
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(t.daemon.String()))
+	return q.shards[h.Sum32()%uint32(len(q.shards))]
+}
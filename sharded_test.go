@@ -0,0 +1,37 @@
+package shezmu
+
+import (
+	"testing"
+)
+
+func TestShardedQueue(t *testing.T) {
+	q := newShardedQueue(4, 0)
+	daemons := []*BaseDaemon{{name: "a"}, {name: "b"}, {name: "c"}}
+	for _, d := range daemons {
+		d.self = d
+		for i := 0; i < 10; i++ {
+			q.Push(&Task{daemon: d, attempt: i}, OverflowBlock)
+		}
+	}
+	if l := q.Len(); l != 30 {
+		t.Fatalf("Expected queue length to be 30, got %d", l)
+	}
+
+	q.Close()
+	next := make(map[Daemon]int)
+	for {
+		task, ok := q.Pop()
+		if !ok {
+			break
+		}
+		if task.attempt != next[task.daemon] {
+			t.Errorf("Expected tasks of daemon %s to keep their order", task.daemon)
+		}
+		next[task.daemon]++
+	}
+	for _, d := range daemons {
+		if n := next[d]; n != 10 {
+			t.Errorf("Expected 10 tasks of daemon %s, got %d", d, n)
+		}
+	}
+}
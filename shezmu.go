@@ -1,12 +1,14 @@
 package shezmu
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
-	"os/signal"
 	"runtime/debug"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -15,220 +17,673 @@ import (
 
 // Shezmu is the master daemon.
 type Shezmu struct {
+	// DaemonStats receives durations and errors of daemon tasks. Publishers
+	// that implement optional interfaces of the stats package, such as
+	// stats.DropPublisher, also receive the corresponding events.
 	DaemonStats stats.Publisher
 	Logger      Logger
-	NumWorkers  int
+	// NumWorkers is the number of workers in a fixed size pool.
+	NumWorkers int
+	// MinWorkers and MaxWorkers make the worker pool elastic when MaxWorkers
+	// is greater than MinWorkers, in which case NumWorkers is ignored. Pool
+	// starts with MinWorkers workers, grows when task wait latency exceeds
+	// ScaleUpLatency and shrinks after workers are idle for ScaleDownIdle.
+	MinWorkers     int
+	MaxWorkers     int
+	ScaleUpLatency time.Duration
+	ScaleDownIdle  time.Duration
+	// QueueSize is the capacity of the task queue. Zero or negative value
+	// makes the queue unbounded.
+	QueueSize int
+	// NewQueue creates task queues for the main pool and dedicated pools.
+	// Defaults to NewPriorityQueue.
+	NewQueue QueueFactory
+	// RestartPolicy defines how crashed system tasks are restarted. Could be
+	// overridden for a daemon with BaseDaemon.SetRestartPolicy. For daemons
+	// that are not part of a group it also limits restart intensity of
+	// OneForAll and RestForOne strategies.
+	RestartPolicy RestartPolicy
+	// Strategy is the supervision strategy for daemons that are not part of a
+	// group.
+	Strategy Strategy
+	// Signals maps OS signals to actions performed by HandleSignals.
+	Signals map[os.Signal]SignalAction
+	// ShutdownTimeout limits the duration of a graceful shutdown caused by a
+	// signal. Zero value means there is no limit.
+	ShutdownTimeout time.Duration
+	// DelayedPolicy defines what happens to pending delayed tasks of daemons
+	// that are being stopped.
+	DelayedPolicy DelayedPolicy
+	// DeadLetters receives tasks that failed permanently. Failed tasks are
+	// only logged if it is nil.
+	DeadLetters DeadLetterSink
+	// WAL is the write-ahead log for durable tasks created with
+	// ProcessDurable.
+	WAL *WAL
+	// WatchdogInterval is the interval between checks for tasks that run
+	// longer than their daemon allows with LimitDuration.
+	WatchdogInterval time.Duration
+	// ReplaceStuckWorkers makes the watchdog start a new worker for every
+	// stuck task, the stuck worker exits once its task is finished.
+	ReplaceStuckWorkers bool
+	// HealthCheckInterval is the interval between health checks of daemons
+	// that implement HealthChecker.
+	HealthCheckInterval time.Duration
+	// HealthCheckTimeout is the time limit of a single health check.
+	HealthCheckTimeout time.Duration
 
 	daemons      []Daemon
-	queue        chan *task
+	pool         *pool
+	root         *Supervisor
 	runtimeStats stats.Manager
+	timers       *timers
 
-	wgWorkers       sync.WaitGroup
-	wgSystem        sync.WaitGroup
-	shutdownWorkers chan struct{}
-	shutdownSystem  chan struct{}
+	mu             sync.Mutex
+	running        bool
+	scaleUp        chan time.Duration
+	shutdownSystem chan struct{}
+
+	events struct {
+		sync.Mutex
+		handlers []EventHandler
+	}
+	inflight struct {
+		sync.Mutex
+		tasks map[*Task]*inflightTask
+	}
 }
 
 // Actor is a function that could be executed by daemon workers.
 type Actor func()
 
-// Logger is the interface that implements minimal logging functions.
-type Logger interface {
-	Printf(format string, v ...interface{})
-	Println(v ...interface{})
-}
+// ContextActor is a function that could be executed by daemon workers. The
+// context is cancelled when daemons are stopped and, for regular tasks, carries
+// a deadline if daemon task duration is limited. A non-nil error is treated as
+// a task failure.
+type ContextActor func(ctx context.Context) error
 
-type task struct {
+// Task is a unit of work created by a daemon and processed by a worker.
+type Task struct {
 	daemon    Daemon
-	actor     Actor
+	actor     ContextActor
 	createdAt time.Time
 	system    bool
+	startup   bool
+	retire    bool
+	priority  Priority
 	name      string
+	queue     holder
+	job       *Job
+	future    *Future
+	retry     *RetryPolicy
+	attempt   int
+	lastErr   error
+	payload   interface{}
+	durable   uint64
+	unique    string
+	collapse  CollapsePolicy
+	debounce  time.Duration
+	startedAt time.Time
+	restarts  int
 }
 
 const (
 	// DefaultNumWorkers is the default number of workers that would process
 	// tasks.
 	DefaultNumWorkers = 100
+	// DefaultQueueSize is the default capacity of the task queue.
+	DefaultQueueSize = 1000
 )
 
+// ErrNotRunning is returned by StartDaemon when daemons were not started with
+// StartDaemons.
+var ErrNotRunning = errors.New("daemons are not running")
+
 // Summon creates a new instance of Shezmu.
 func Summon() *Shezmu {
-	return &Shezmu{
-		DaemonStats:     &stats.Void{},
-		Logger:          log.New(os.Stdout, "", log.LstdFlags),
-		NumWorkers:      DefaultNumWorkers,
-		queue:           make(chan *task),
-		runtimeStats:    stats.NewBasicStats(),
-		shutdownWorkers: make(chan struct{}),
-		shutdownSystem:  make(chan struct{}),
+	s := &Shezmu{
+		DaemonStats:         &stats.Void{},
+		Logger:              NewStdLogger(log.New(os.Stdout, "", log.LstdFlags), LevelInfo),
+		NumWorkers:          DefaultNumWorkers,
+		ScaleUpLatency:      DefaultScaleUpLatency,
+		ScaleDownIdle:       DefaultScaleDownIdle,
+		QueueSize:           DefaultQueueSize,
+		WatchdogInterval:    DefaultWatchdogInterval,
+		HealthCheckInterval: DefaultHealthCheckInterval,
+		HealthCheckTimeout:  DefaultHealthCheckTimeout,
+		NewQueue:            NewPriorityQueue,
+		RestartPolicy:       DefaultRestartPolicy,
+		Strategy:            OneForOne,
+		Signals: map[os.Signal]SignalAction{
+			syscall.SIGINT:  SignalStop,
+			syscall.SIGTERM: SignalStop,
+			syscall.SIGHUP:  SignalReload,
+			syscall.SIGUSR1: SignalDump,
+		},
+		root:           &Supervisor{},
+		runtimeStats:   stats.NewBasicStats(),
+		timers:         newTimers(),
+		scaleUp:        make(chan time.Duration, 1),
+		shutdownSystem: make(chan struct{}),
 	}
+	s.inflight.tasks = make(map[*Task]*inflightTask)
+
+	return s
 }
 
-// AddDaemon adds a new daemon.
-func (s *Shezmu) AddDaemon(d Daemon) {
+// AddDaemon adds a new daemon. An error is returned if the daemon creates a
+// dependency cycle, in which case it is not added.
+func (s *Shezmu) AddDaemon(d Daemon) error {
 	base := d.base()
 	base.self = d
-	base.queue = s.queue
+	base.shezmu = s
 	base.logger = s.Logger
-	base.shutdown = s.shutdownSystem
 
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := checkDependencies(s.daemons, d); err != nil {
+		s.Logger.Log(LevelError, "Failed to add daemon", F("daemon", d.String()), F("error", err))
+		return err
+	}
 	s.daemons = append(s.daemons, d)
+
+	return nil
 }
 
 // ClearDaemons clears the list of added daemons. StopDaemons() function MUST be
 // called before calling ClearDaemons().
 func (s *Shezmu) ClearDaemons() {
+	s.mu.Lock()
 	s.daemons = []Daemon{}
+	s.mu.Unlock()
 }
 
 // StartDaemons starts all registered daemons.
 func (s *Shezmu) StartDaemons() {
-	s.Logger.Printf("Starting %d workers", s.NumWorkers)
-	for i := 0; i < s.NumWorkers; i++ {
-		go s.runWorker()
+	p := newPool(s.NewQueue(s.QueueSize))
+	s.mu.Lock()
+	s.pool = p
+	s.running = true
+	s.mu.Unlock()
+
+	n := s.initialWorkers()
+	s.Logger.Log(LevelInfo, "Starting workers", F("workers", n))
+	s.startWorkers(p, n)
+	if s.elastic() {
+		go s.scale(p)
 	}
+	go s.runTimers()
+	go s.watchdog()
+	go s.healthChecks()
 
-	s.Logger.Println("Setting up daemons")
-	for _, d := range s.daemons {
+	s.Logger.Log(LevelInfo, "Setting up daemons")
+	for _, d := range sortDaemons(s.daemonList()) {
 		s.setupDaemon(d)
 	}
+	s.replay()
 }
 
-// StopDaemons stops all running daemons.
+// StopDaemons stops all running daemons and waits for all accepted tasks to
+// be processed. See StopDaemonsWithTimeout for details.
 func (s *Shezmu) StopDaemons() {
-	close(s.shutdownSystem)
-	for _, d := range s.daemons {
-		d.Shutdown()
+	s.StopDaemonsWithTimeout(context.Background())
+	s.logStats(stats.Latency)
+}
+
+// Workers returns the number of running workers in the main pool.
+func (s *Shezmu) Workers() int {
+	if p := s.mainPool(); p != nil {
+		return p.size()
 	}
 
-	s.wgSystem.Wait()
-	close(s.shutdownWorkers)
+	return 0
+}
 
-	s.wgWorkers.Wait()
-	close(s.queue)
+// Stats returns runtime statistics such as stats.Latency, stats.ScaleUp and
+// stats.ScaleDown. Latency is the time tasks wait in the queue before a worker
+// takes them.
+func (s *Shezmu) Stats(name string) stats.Stats {
+	return s.runtimeStats.Fetch(name)
+}
+
+// logStats writes runtime statistics with given name to the logger.
+func (s *Shezmu) logStats(name string) {
+	st := s.runtimeStats.Fetch(name)
+	s.Logger.Log(LevelInfo, "Runtime statistics",
+		F("name", name),
+		F("processed", st.Processed()),
+		F("min", time.Duration(st.Min())),
+		F("mean", time.Duration(st.Mean())),
+		F("p95", time.Duration(st.P95())),
+		F("max", time.Duration(st.Max())),
+		F("stddev", time.Duration(st.StdDev())))
+}
 
-	// Re-open closed channels to allow starting new deamons afterwards
-	s.shutdownSystem = make(chan struct{})
-	s.shutdownWorkers = make(chan struct{})
-	s.queue = make(chan *task)
+// StartDaemon starts a single registered daemon. Daemons must be started with
+// StartDaemons first.
+func (s *Shezmu) StartDaemon(name string) error {
+	d, err := s.lookup(name)
+	if err != nil {
+		return err
+	}
 
-	fmt.Println(s.runtimeStats.Fetch(stats.Latency))
+	s.mu.Lock()
+	running := s.running
+	s.mu.Unlock()
+	if !running {
+		return ErrNotRunning
+	}
+
+	d.base().log(LevelInfo, "Starting daemon")
+	s.setupDaemon(d)
+	return nil
 }
 
-func (s *Shezmu) HandleSignals() {
-	ch := make(chan os.Signal)
-	signal.Notify(ch, syscall.SIGINT)
-	for {
-		switch sig := <-ch; sig {
-		case syscall.SIGINT:
-			s.StopDaemons()
-			return
-		default:
-			s.Logger.Printf("Signal ignored: %s", sig)
+// StopDaemon stops a single daemon and waits for its system tasks to finish.
+// Other daemons keep running.
+func (s *Shezmu) StopDaemon(name string) error {
+	d, err := s.lookup(name)
+	if err != nil {
+		return err
+	}
+
+	d.base().log(LevelInfo, "Stopping daemon")
+	s.flushTimers(d)
+	s.stopDaemons([]Daemon{d})
+	return nil
+}
+
+// RestartDaemon stops a single daemon and then starts it again.
+func (s *Shezmu) RestartDaemon(name string) error {
+	if err := s.StopDaemon(name); err != nil {
+		return err
+	}
+
+	return s.StartDaemon(name)
+}
+
+// RemoveDaemon stops a single daemon and removes it from the list of
+// registered daemons.
+func (s *Shezmu) RemoveDaemon(name string) error {
+	if err := s.StopDaemon(name); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.daemons = removeDaemon(s.daemons, name)
+	for _, d := range s.daemons {
+		if sup := d.base().supervisor; sup != nil {
+			sup.daemons = removeDaemon(sup.daemons, name)
 		}
 	}
+
+	return nil
 }
 
 func (s *Shezmu) setupDaemon(d Daemon) {
-	defer func() {
-		if err := recover(); err != nil {
-			s.Logger.Printf("Failed to setup daemon %s due to process termination", d)
-		}
-	}()
+	p := s.mainPool()
+	if p == nil {
+		d.base().log(LevelWarn, "Failed to setup daemon because daemons are not running")
+		return
+	}
+
+	base := d.base()
+	if !base.start(p.queue) {
+		base.log(LevelWarn, "Daemon is already running")
+		return
+	}
+	if dp, n := base.dedicatedPool(); dp != nil {
+		base.log(LevelInfo, "Starting dedicated workers", F("workers", n))
+		s.startWorkers(dp, n)
+	}
 
-	s.queue <- &task{
+	t := &Task{
 		daemon:    d,
-		actor:     d.Startup,
+		actor:     contextActor(d.Startup),
 		createdAt: time.Now(),
 		system:    true,
+		startup:   true,
+		priority:  PriorityCritical,
 		name:      "startup",
 	}
+	if len(dependencies(d)) == 0 {
+		base.tryEnqueue(t)
+		return
+	}
+
+	go func() {
+		if s.waitForDependencies(d) {
+			t.createdAt = time.Now()
+			base.tryEnqueue(t)
+		}
+	}()
+}
+
+// stopDaemons requests shutdown of given daemons and waits for their system
+// tasks to finish.
+func (s *Shezmu) stopDaemons(daemons []Daemon) {
+	var stopping []Daemon
+	for _, d := range daemons {
+		// Paused daemon is resumed before it is stopped, so that its held
+		// tasks are queued again while queues are still open
+		if d.base().resume() {
+			stats.Resume(s.DaemonStats, d.String())
+			d.base().emit(Event{Type: EventResumed})
+		}
+		if d.base().stop() {
+			stopping = append(stopping, d)
+		}
+	}
+	for _, d := range stopping {
+		d.base().stopJobs()
+		d.Shutdown()
+	}
+	for _, d := range stopping {
+		base := d.base()
+		base.lifecycle.wg.Wait()
+		// Queue is detached once system tasks are finished, so that tasks
+		// added by Shutdown are still processed
+		base.detach()
+		// Dedicated pool is drained after daemon system tasks are finished
+		if dp, _ := base.dedicatedPool(); dp != nil {
+			dp.queue.Close()
+			dp.wg.Wait()
+		}
+		base.setState(StateStopped, nil)
+	}
+}
+
+// mainPool returns the worker pool shared by all daemons.
+func (s *Shezmu) mainPool() *pool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.pool
+}
+
+// lookup finds a registered daemon by its name.
+func (s *Shezmu) lookup(name string) (Daemon, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, d := range s.daemons {
+		if d.String() == name {
+			return d, nil
+		}
+	}
+
+	return nil, fmt.Errorf("Daemon %q is not found", name)
 }
 
-func (s *Shezmu) runWorker() {
-	s.wgWorkers.Add(1)
-	defer s.wgWorkers.Done()
+// daemonList returns a copy of the list of registered daemons.
+func (s *Shezmu) daemonList() []Daemon {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Daemon{}, s.daemons...)
+}
+
+// stopped returns a channel that is closed when all daemons are stopped.
+func (s *Shezmu) stopped() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.shutdownSystem
+}
+
+func (s *Shezmu) runWorker(p *pool) {
+	atomic.AddInt64(&p.workers, 1)
+	defer atomic.AddInt64(&p.workers, -1)
 	defer func() {
 		if err := recover(); err != nil {
-			s.Logger.Printf("Worker crashed. Error: %v\n", err)
-			debug.PrintStack()
-			go s.runWorker() // Restarting worker
+			s.Logger.Log(LevelError, "Worker crashed",
+				F("error", interfaceToError(err)), F("stack", debug.Stack()))
+			go s.runWorker(p) // Restarting worker
+		} else {
+			p.wg.Done()
 		}
 	}()
 
 	for {
-		select {
-		case t := <-s.queue:
-			s.processTask(t)
-		case <-s.shutdownWorkers:
+		t, ok := p.queue.Pop()
+		if !ok || t.retire {
+			return
+		}
+		if s.processTask(p, t) {
 			return
 		}
 	}
 }
 
-func (s *Shezmu) processTask(t *task) {
+// processTask processes a task taken from the pool queue. It returns true if
+// the worker was replaced by the watchdog and should exit.
+func (s *Shezmu) processTask(p *pool, t *Task) (replaced bool) {
 	dur := time.Now().Sub(t.createdAt)
 	s.runtimeStats.Add(stats.Latency, dur)
+	if p == s.mainPool() {
+		s.reportLatency(dur)
+	}
+
+	atomic.AddInt64(&p.busy, 1)
+	defer atomic.AddInt64(&p.busy, -1)
 
 	if t.system {
 		s.processSystemTask(t)
+		return false
+	}
+
+	// Tasks over daemon concurrency limit are held until one of its running
+	// tasks finishes and then processed by the worker that released the slot
+	base := t.daemon.base()
+	if !base.acquire(t) {
+		return false
+	}
+	for t != nil {
+		if s.processGeneralTask(p, t) {
+			replaced = true
+		}
+		t = base.release()
+	}
+
+	return replaced
+}
+
+func (s *Shezmu) processSystemTask(t *Task) {
+	// Abort starting a system task if daemon shutdown was already called. This
+	// should be an extremely rare scenario when a system task crashes and
+	// tries to restart after a shutdown call.
+	base := t.daemon.base()
+	if !base.enterSystemTask() {
+		return
+	}
+	defer base.exitSystemTask()
+	s.trackTask(t, nil, nil)
+	defer s.untrackTask(t)
+	defer func() {
+		if val := recover(); val != nil {
+			err := interfaceToError(val)
+			s.Logger.Log(LevelError, "System task recovered from a panic",
+				t.fields(F("error", err), F("stack", debug.Stack()))...)
+			base.emit(Event{Type: EventPanic, Task: t.String(), Err: err})
+			s.handleCrash(t.daemon, t, err)
+		}
+	}()
+
+	s.Logger.Log(LevelDebug, "Starting system task", t.fields()...)
+	base.recoverState(t.startup)
+	t.startedAt = time.Now()
+	ctx := base.Context()
+	err := t.actor(ctx) // <--- ACTION STARTS HERE
+	// Errors caused by context cancellation are expected during shutdown
+	if err != nil && ctx.Err() == nil {
+		s.Logger.Log(LevelError, "System task failed",
+			t.fields(F("error", err), F("duration", time.Now().Sub(t.startedAt)))...)
+		s.handleCrash(t.daemon, t, err)
 	} else {
-		s.processGeneralTask(t)
+		s.Logger.Log(LevelDebug, "System task finished",
+			t.fields(F("duration", time.Now().Sub(t.startedAt)))...)
+		if t.startup {
+			base.markStarted()
+		}
 	}
 }
 
-func (s *Shezmu) processSystemTask(t *task) {
-	// Abort starting a system task if shutdown was already called. Otherwise
-	// incrementing a wait group counter will cause a panic. This should be an
-	// extremely rare scenario when a system task crashes and tries to restart
-	// after a shutdown call.
-	select {
-	case <-s.shutdownSystem:
+// restartSystemTask schedules a crashed system task for restart according to
+// the daemon restart policy.
+func (s *Shezmu) restartSystemTask(t *Task, err error) {
+	base := t.daemon.base()
+	p := s.RestartPolicy
+	if base.restart != nil {
+		p = *base.restart
+	}
+
+	if !base.restarts.allow(p) {
+		s.Logger.Log(LevelError, "System task exhausted its restart budget, daemon is marked as failed",
+			t.fields(F("error", err))...)
+		base.fail(err)
 		return
-	default:
 	}
 
-	s.wgSystem.Add(1)
-	defer s.wgSystem.Done()
-	defer func() {
-		if err := recover(); err != nil {
-			s.Logger.Printf("System task %s recovered from a panic\nError: %v\n", t, err)
-			debug.PrintStack()
+	if p.MaxDelay > 0 && time.Now().Sub(t.startedAt) > p.MaxDelay {
+		t.restarts = 0
+	}
+	if t.restarts > 0 {
+		// Task crashed again before it could be considered recovered
+		base.markCrashLoop(err, p.MaxDelay)
+	}
+	delay := p.delay(t.restarts)
+	t.restarts++
+	base.emit(Event{Type: EventRestart, Task: t.String(), Err: err, Delay: delay})
 
+	if delay <= 0 {
+		t.createdAt = time.Now()
+		base.tryEnqueue(t)
+		return
+	}
+
+	s.Logger.Log(LevelInfo, "Restarting system task", t.fields(F("delay", delay), F("restarts", t.restarts))...)
+	shutdown := base.shutdown
+	time.AfterFunc(delay, func() {
+		select {
+		case <-shutdown:
+			// Daemon was stopped while restart was pending
+		default:
 			t.createdAt = time.Now()
-			s.queue <- t // Restarting task
-		} else {
-			s.Logger.Printf("System task %s finished\n", t)
+			base.tryEnqueue(t)
 		}
-	}()
-
-	s.Logger.Printf("Starting system task %s\n", t)
-	t.actor() // <--- ACTION STARTS HERE
+	})
 }
 
-func (s *Shezmu) processGeneralTask(t *task) {
+// processGeneralTask processes a regular task. It returns true if the worker
+// was replaced by the watchdog and should exit.
+func (s *Shezmu) processGeneralTask(p *pool, t *Task) (replaced bool) {
+	ctx, cancel := t.daemon.base().taskContext()
+	defer cancel()
+	s.trackTask(t, p, cancel)
+	defer func() {
+		replaced = s.untrackTask(t)
+	}()
 	defer func() {
 		if val := recover(); val != nil {
 			err := interfaceToError(val)
+			stack := debug.Stack()
+			s.Logger.Log(LevelError, "Task recovered from a panic", t.fields(F("error", err), F("stack", stack))...)
+			t.daemon.base().emit(Event{Type: EventPanic, Task: t.String(), Err: err})
+			if s.retryTask(t, &PanicError{Value: val}) {
+				return
+			}
+
 			s.DaemonStats.Error(t.daemon.String())
+			s.deadLetter(t, err, stack)
+			s.finishDurable(t)
 			t.daemon.base().handlePanic(err)
-			s.Logger.Printf("Daemon %s recovered from a panic\nError: %s\n", t.daemon, err.Error())
-			debug.PrintStack()
+			if sup := t.daemon.base().supervisor; sup != nil && sup.EscalatePanics {
+				s.handleCrash(t.daemon, nil, err)
+			}
+			t.complete(nil, val)
 		}
 	}()
-	defer func(start time.Time) {
-		dur := time.Now().Sub(start)
-		s.DaemonStats.Add(t.daemon.String(), dur)
-	}(time.Now())
+	start := time.Now()
+	defer func() {
+		s.DaemonStats.Add(t.daemon.String(), time.Now().Sub(start))
+	}()
+
+	err := t.actor(ctx) // <--- ACTION STARTS HERE
+	if err != nil {
+		if s.retryTask(t, err) {
+			return
+		}
+		s.DaemonStats.Error(t.daemon.String())
+		s.Logger.Log(LevelError, "Task failed", t.fields(F("error", err), F("duration", time.Now().Sub(start)))...)
+		s.deadLetter(t, err, nil)
+	}
+	s.finishDurable(t)
+	t.complete(err, nil)
+
+	return
+}
+
+// Daemon returns the daemon that created the task.
+func (t *Task) Daemon() Daemon {
+	return t.daemon
+}
+
+// Priority returns the task priority.
+func (t *Task) Priority() Priority {
+	return t.priority
+}
+
+// System returns true for system tasks. Queues must never drop them.
+func (t *Task) System() bool {
+	return t.system
+}
 
-	t.actor() // <--- ACTION STARTS HERE
+// CreatedAt returns the time the task was created at.
+func (t *Task) CreatedAt() time.Time {
+	return t.createdAt
 }
 
-func (t *task) String() string {
+func (t *Task) String() string {
 	return fmt.Sprintf("%s[%s]", t.daemon, t.name)
 }
 
+// complete is called when a task is processed, failed without further retries
+// or dropped without being processed. Val is the recovered panic value.
+func (t *Task) complete(err error, val interface{}) {
+	if t.unique != "" {
+		t.daemon.base().releaseUnique(t.unique, t)
+	}
+	if t.job != nil {
+		t.job.done()
+	}
+	if t.future != nil {
+		t.future.resolve(err, val)
+	}
+}
+
+// removeDaemon returns a copy of the list without the daemon with given name.
+func removeDaemon(daemons []Daemon, name string) []Daemon {
+	var list []Daemon
+	for _, d := range daemons {
+		if d.String() != name {
+			list = append(list, d)
+		}
+	}
+
+	return list
+}
+
+// contextActor converts an Actor to a ContextActor that never fails.
+func contextActor(a Actor) ContextActor {
+	return func(context.Context) error {
+		a()
+		return nil
+	}
+}
+
 func interfaceToError(val interface{}) error {
 	if terr, ok := val.(error); ok {
 		return terr
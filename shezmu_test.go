@@ -0,0 +1,65 @@
+package shezmu
+
+import (
+	"context"
+	"testing"
+)
+
+type testDaemon struct {
+	BaseDaemon
+}
+
+func newTestShezmu(daemons ...Daemon) *Shezmu {
+	s := Summon()
+	s.Logger = NopLogger{}
+	s.NumWorkers = 2
+	for _, d := range daemons {
+		s.AddDaemon(d)
+	}
+
+	return s
+}
+
+func TestStopDaemon(t *testing.T) {
+	d1 := &testDaemon{BaseDaemon{name: "first"}}
+	d2 := &testDaemon{BaseDaemon{name: "second"}}
+	s := newTestShezmu(d1, d2)
+	s.StartDaemons()
+	defer s.StopDaemons()
+
+	if err := s.StopDaemon("first"); err != nil {
+		t.Fatal(err)
+	}
+	if st := d1.State(); st != StateStopped {
+		t.Errorf("Expected stopped daemon to be in stopped state, got %s", st)
+	}
+	var ran bool
+	err := d1.ProcessWait(func(context.Context) error {
+		ran = true
+		return nil
+	})
+	if err != ErrNotRunning || ran {
+		t.Errorf("Expected tasks of a stopped daemon to fail with ErrNotRunning, got %v", err)
+	}
+
+	if started, _ := d2.startedChan(); started != nil {
+		<-started
+	}
+	if st := d2.State(); st != StateRunning {
+		t.Errorf("Expected other daemon to keep running, got %s", st)
+	}
+	err = d2.ProcessWait(func(context.Context) error {
+		ran = true
+		return nil
+	})
+	if err != nil || !ran {
+		t.Errorf("Expected tasks of other daemon to be processed, got %v", err)
+	}
+
+	if err := s.StartDaemon("first"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d1.ProcessWait(func(context.Context) error { return nil }); err != nil {
+		t.Errorf("Expected tasks of a restarted daemon to be processed, got %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package shezmu
+
+import (
+	"context"
+	"sort"
+)
+
+// ShutdownReport describes the work that was left unfinished after a graceful
+// shutdown deadline was reached.
+type ShutdownReport struct {
+	// Abandoned contains tasks that were accepted but never started.
+	Abandoned []string
+	// Running contains tasks that were still running at the deadline.
+	Running []string
+	// Daemons contains names of daemons that had system tasks running at the
+	// deadline.
+	Daemons []string
+}
+
+// StopDaemonsWithTimeout gracefully stops all running daemons. First it
+// handles pending delayed tasks according to DelayedPolicy, then stops
+// daemons in reverse dependency order while workers keep processing the tasks
+// that were already accepted. Task queues are closed once all daemons are
+// stopped, so that tasks added by Shutdown functions are still processed. If
+// the context is done before everything stops, remaining queued tasks are
+// abandoned and the context error is returned along with a report of
+// unfinished work. Daemons and tasks that did not stop in time continue
+// stopping in background.
+func (s *Shezmu) StopDaemonsWithTimeout(ctx context.Context) (*ShutdownReport, error) {
+	s.mu.Lock()
+	if !s.running || s.pool == nil {
+		s.mu.Unlock()
+		return &ShutdownReport{}, nil
+	}
+	s.running = false
+	close(s.shutdownSystem)
+	p := s.pool
+	s.mu.Unlock()
+
+	daemons := sortDaemons(s.daemonList())
+	s.flushTimers()
+
+	done := make(chan struct{})
+	go func() {
+		s.stopInOrder(daemons)
+		// Delayed tasks that were created while stopping are never due
+		s.flushTimers()
+		// Stop intake, accepted tasks are still processed
+		p.queue.Close()
+		p.wg.Wait()
+		close(done)
+	}()
+
+	report := &ShutdownReport{}
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		report = s.shutdownReport(p, daemons)
+		s.Logger.Log(LevelWarn, "Shutdown deadline reached",
+			F("abandoned", len(report.Abandoned)), F("running", len(report.Running)), F("daemons", len(report.Daemons)))
+	}
+
+	// Re-open closed channels to allow starting new deamons afterwards
+	s.mu.Lock()
+	s.shutdownSystem = make(chan struct{})
+	s.mu.Unlock()
+
+	return report, err
+}
+
+func (s *Shezmu) shutdownReport(p *pool, daemons []Daemon) *ShutdownReport {
+	report := &ShutdownReport{}
+	abandoned := abandonQueue(p.queue)
+	for _, d := range daemons {
+		if dp, _ := d.base().dedicatedPool(); dp != nil {
+			abandoned = append(abandoned, abandonQueue(dp.queue)...)
+		}
+		abandoned = append(abandoned, d.base().abandonHeld()...)
+	}
+	for _, t := range abandoned {
+		t.complete(ErrQueueClosed, nil)
+		if !t.retire {
+			report.Abandoned = append(report.Abandoned, t.String())
+		}
+	}
+	for _, d := range daemons {
+		if d.base().systemTasks() > 0 {
+			report.Daemons = append(report.Daemons, d.String())
+		}
+	}
+	for _, t := range s.runningTasks() {
+		report.Running = append(report.Running, t.String())
+	}
+	sort.Strings(report.Running)
+
+	return report
+}
+
+// runningTasks returns the list of tasks that are being processed.
+func (s *Shezmu) runningTasks() []*Task {
+	s.inflight.Lock()
+	defer s.inflight.Unlock()
+
+	tasks := make([]*Task, 0, len(s.inflight.tasks))
+	for t := range s.inflight.tasks {
+		tasks = append(tasks, t)
+	}
+
+	return tasks
+}
@@ -0,0 +1,93 @@
+package shezmu
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+type shutdownDaemon struct {
+	BaseDaemon
+	shutdown func()
+}
+
+func (d *shutdownDaemon) Shutdown() {
+	d.shutdown()
+}
+
+func TestStopDaemonsNotStarted(t *testing.T) {
+	s := newTestShezmu(&testDaemon{BaseDaemon{name: "test"}})
+
+	report, err := s.StopDaemonsWithTimeout(context.Background())
+	if err != nil || len(report.Abandoned)+len(report.Running)+len(report.Daemons) > 0 {
+		t.Errorf("Expected nothing to be stopped, got %+v, %v", report, err)
+	}
+}
+
+func TestShutdownProcessesLastBatch(t *testing.T) {
+	d := &shutdownDaemon{BaseDaemon: BaseDaemon{name: "test"}}
+	var ran int
+	d.shutdown = func() {
+		for i := 0; i < 3; i++ {
+			d.Process(func() { ran++ })
+		}
+	}
+	s := newTestShezmu(d)
+	s.NumWorkers = 1
+	s.StartDaemons()
+	s.StopDaemons()
+
+	if ran != 3 {
+		t.Errorf("Expected tasks added by Shutdown to be processed, %d of 3 ran", ran)
+	}
+}
+
+func TestShutdownReport(t *testing.T) {
+	d := &testDaemon{BaseDaemon{name: "test"}}
+	s := newTestShezmu(d)
+	s.StartDaemons()
+
+	block := make(chan struct{})
+	loop := make(chan struct{})
+	d.SystemProcess("loop", func() {
+		close(loop)
+		<-block
+	})
+	<-loop
+	running := make(chan struct{})
+	d.Process(func() {
+		close(running)
+		<-block
+	})
+	<-running
+	abandoned := []*Future{
+		d.Submit(func() (interface{}, error) { return nil, nil }),
+		d.Submit(func() (interface{}, error) { return nil, nil }),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	report, err := s.StopDaemonsWithTimeout(ctx)
+	close(block)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected deadline to be exceeded, got %v", err)
+	}
+
+	if exp := []string{"test[Actor]", "test[Actor]"}; !reflect.DeepEqual(report.Abandoned, exp) {
+		t.Errorf("Expected abandoned tasks to be %v, got %v", exp, report.Abandoned)
+	}
+	sort.Strings(report.Running)
+	if exp := []string{"test[Actor]", "test[loop]"}; !reflect.DeepEqual(report.Running, exp) {
+		t.Errorf("Expected running tasks to be %v, got %v", exp, report.Running)
+	}
+	if exp := []string{"test"}; !reflect.DeepEqual(report.Daemons, exp) {
+		t.Errorf("Expected daemons to be %v, got %v", exp, report.Daemons)
+	}
+	for i, f := range abandoned {
+		if _, err := f.Wait(); err != ErrQueueClosed {
+			t.Errorf("Expected abandoned task #%d to fail with ErrQueueClosed, got %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package shezmu
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync/atomic"
+
+	"github.com/localhots/shezmu/stats"
+)
+
+// SignalAction is an action that is performed by HandleSignals when a signal
+// is received.
+type SignalAction int
+
+const (
+	// SignalIgnore makes HandleSignals ignore the signal.
+	SignalIgnore SignalAction = iota
+	// SignalStop gracefully stops all daemons within Shezmu.ShutdownTimeout
+	// and makes HandleSignals return.
+	SignalStop
+	// SignalReload calls Reload function of every daemon that implements the
+	// Reloader interface and restarts all other daemons.
+	SignalReload
+	// SignalDump writes the state of tasks, workers and daemons to the logger.
+	SignalDump
+)
+
+// Reloader is the interface that could be implemented by daemons that are able
+// to reload without a restart.
+type Reloader interface {
+	Reload()
+}
+
+// HandleSignals performs actions defined in Shezmu.Signals when signals are
+// received. It blocks until a stop signal is received or daemons are stopped.
+func (s *Shezmu) HandleSignals() {
+	ch := make(chan os.Signal, 1)
+	for sig := range s.Signals {
+		signal.Notify(ch, sig)
+	}
+	defer signal.Stop(ch)
+
+	stopped := s.stopped()
+	for {
+		select {
+		case sig := <-ch:
+			switch s.Signals[sig] {
+			case SignalStop:
+				s.Logger.Log(LevelInfo, "Received signal, stopping daemons", F("signal", sig))
+				s.stopWithTimeout()
+				return
+			case SignalReload:
+				s.Logger.Log(LevelInfo, "Received signal, reloading daemons", F("signal", sig))
+				s.reload()
+			case SignalDump:
+				s.dump()
+			default:
+				s.Logger.Log(LevelWarn, "Signal ignored", F("signal", sig))
+			}
+		case <-stopped:
+			return
+		}
+	}
+}
+
+func (s *Shezmu) stopWithTimeout() {
+	ctx := context.Background()
+	if s.ShutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.ShutdownTimeout)
+		defer cancel()
+	}
+
+	s.StopDaemonsWithTimeout(ctx)
+}
+
+// reload reloads running daemons that implement the Reloader interface and
+// restarts the rest of running daemons in dependency order. Daemons that were
+// stopped with StopDaemon stay stopped and paused daemons are paused again
+// after the restart.
+func (s *Shezmu) reload() {
+	var restart []Daemon
+	paused := make(map[Daemon]bool)
+	for _, d := range sortDaemons(s.daemonList()) {
+		if !d.base().isRunning() {
+			continue
+		}
+		if r, ok := d.(Reloader); ok {
+			d.base().log(LevelInfo, "Reloading daemon")
+			r.Reload()
+		} else {
+			restart = append(restart, d)
+			paused[d] = d.base().IsPaused()
+		}
+	}
+
+	s.stopInOrder(restart)
+	for _, d := range restart {
+		s.setupDaemon(d)
+		if paused[d] {
+			s.PauseDaemon(d.String())
+		}
+	}
+}
+
+// dump writes the state of tasks, workers and daemons to the logger.
+func (s *Shezmu) dump() {
+	if p := s.mainPool(); p != nil {
+		s.Logger.Log(LevelInfo, "Workers",
+			F("workers", p.size()), F("busy", atomic.LoadInt64(&p.busy)), F("queued", p.queue.Len()))
+	}
+	s.Logger.Log(LevelInfo, "Delayed tasks", F("tasks", s.timers.len()))
+
+	for _, t := range s.runningTasks() {
+		s.Logger.Log(LevelInfo, "Running task", t.fields()...)
+	}
+	for _, d := range s.daemonList() {
+		base := d.base()
+		base.log(LevelInfo, "Daemon", F("state", base.State()), F("health", base.health().State),
+			F("paused", base.IsPaused()), F("system_tasks", base.systemTasks()))
+		if p, _ := base.dedicatedPool(); p != nil {
+			base.log(LevelInfo, "Dedicated workers",
+				F("workers", p.size()), F("busy", atomic.LoadInt64(&p.busy)), F("queued", p.queue.Len()))
+		}
+	}
+	for _, name := range []string{stats.Latency, stats.ScaleUp, stats.ScaleDown} {
+		s.logStats(name)
+	}
+}
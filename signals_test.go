@@ -0,0 +1,144 @@
+package shezmu
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type reloaderDaemon struct {
+	startupDaemon
+	reloads int64
+}
+
+func (d *reloaderDaemon) Reload() {
+	atomic.AddInt64(&d.reloads, 1)
+}
+
+type recordLogger struct {
+	sync.Mutex
+	messages map[string][]Field
+}
+
+func (l *recordLogger) Log(level Level, msg string, fields ...Field) {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.messages == nil {
+		l.messages = make(map[string][]Field)
+	}
+	l.messages[msg] = append(l.messages[msg], fields...)
+}
+
+func waitStarted(daemons ...Daemon) {
+	for _, d := range daemons {
+		if started, ok := d.base().startedChan(); ok {
+			<-started
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	reloaded := &reloaderDaemon{startupDaemon: startupDaemon{BaseDaemon: BaseDaemon{name: "reloaded"}}}
+	restarted := &startupDaemon{BaseDaemon: BaseDaemon{name: "restarted"}}
+	stopped := &startupDaemon{BaseDaemon: BaseDaemon{name: "stopped"}}
+	paused := &startupDaemon{BaseDaemon: BaseDaemon{name: "paused"}}
+	s := newTestShezmu(reloaded, restarted, stopped, paused)
+	s.StartDaemons()
+	defer s.StopDaemons()
+	waitStarted(reloaded, restarted, stopped, paused)
+	s.StopDaemon("stopped")
+	s.PauseDaemon("paused")
+
+	s.reload()
+	waitStarted(reloaded, restarted, paused)
+
+	if n := atomic.LoadInt64(&reloaded.reloads); n != 1 {
+		t.Errorf("Expected reloader to be reloaded once, got %d", n)
+	}
+	for _, exp := range []struct {
+		d      *startupDaemon
+		starts int64
+		state  DaemonState
+	}{
+		{&reloaded.startupDaemon, 1, StateRunning},
+		{restarted, 2, StateRunning},
+		{stopped, 1, StateStopped},
+		{paused, 2, StateRunning},
+	} {
+		if n := atomic.LoadInt64(&exp.d.starts); n != exp.starts {
+			t.Errorf("Expected %s to be started %d times, got %d", exp.d, exp.starts, n)
+		}
+		if st := exp.d.State(); st != exp.state {
+			t.Errorf("Expected %s to be %s, got %s", exp.d, exp.state, st)
+		}
+	}
+	if !paused.IsPaused() {
+		t.Error("Expected paused daemon to stay paused after reload")
+	}
+}
+
+func TestDump(t *testing.T) {
+	l := &recordLogger{}
+	s := Summon()
+	s.Logger = l
+	d := &testDaemon{BaseDaemon{name: "test"}}
+	s.AddDaemon(d)
+	s.StartDaemons()
+	defer s.StopDaemons()
+	waitStarted(d)
+
+	s.dump()
+	l.Lock()
+	defer l.Unlock()
+	for _, msg := range []string{"Workers", "Delayed tasks", "Daemon", "Runtime statistics"} {
+		if _, ok := l.messages[msg]; !ok {
+			t.Errorf("Expected dump to contain %q message", msg)
+		}
+	}
+	fields := make(map[string]interface{})
+	for _, f := range l.messages["Daemon"] {
+		fields[f.Key] = f.Value
+	}
+	if fields["daemon"] != "test" || fields["state"] != StateRunning || fields["paused"] != false {
+		t.Errorf("Unexpected daemon dump fields: %v", fields)
+	}
+}
+
+func TestHandleSignalsStop(t *testing.T) {
+	d := &testDaemon{BaseDaemon{name: "test"}}
+	s := newTestShezmu(d)
+	s.Signals = map[os.Signal]SignalAction{syscall.SIGUSR2: SignalStop}
+	s.StartDaemons()
+	waitStarted(d)
+
+	// Keeps the signal from terminating the process before HandleSignals
+	// subscribes to it
+	guard := make(chan os.Signal, 1)
+	signal.Notify(guard, syscall.SIGUSR2)
+	defer signal.Stop(guard)
+
+	done := make(chan struct{})
+	go func() {
+		s.HandleSignals()
+		close(done)
+	}()
+	deadline := time.After(time.Second)
+	for {
+		syscall.Kill(os.Getpid(), syscall.SIGUSR2)
+		select {
+		case <-done:
+			if st := d.State(); st != StateStopped {
+				t.Errorf("Expected daemon to be stopped, got %s", st)
+			}
+			return
+		case <-deadline:
+			t.Fatal("Expected HandleSignals to return after a stop signal")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
@@ -20,9 +20,45 @@ type Publisher interface {
 	Error(name string)
 }
 
+// DropPublisher is implemented by publishers that record tasks dropped because
+// of a full queue.
+type DropPublisher interface {
+	Drop(name string)
+}
+
+// RetryPublisher is implemented by publishers that record retries of failed
+// tasks.
+type RetryPublisher interface {
+	Retry(name string)
+}
+
+// CollapsePublisher is implemented by publishers that record unique tasks
+// collapsed into the ones already queued.
+type CollapsePublisher interface {
+	Collapse(name string)
+}
+
+// TimeoutPublisher is implemented by publishers that record tasks running
+// longer than their daemon allows.
+type TimeoutPublisher interface {
+	Timeout(name string)
+}
+
+// PausePublisher is implemented by publishers that record pausing and resuming
+// of daemons.
+type PausePublisher interface {
+	Pause(name string)
+	Resume(name string)
+}
+
 type Stats interface {
 	Processed() int64
 	Errors() int64
+	Dropped() int64
+	Retried() int64
+	Collapsed() int64
+	TimedOut() int64
+	Paused() bool
 	Min() int64
 	Mean() float64
 	P95() float64
@@ -33,9 +69,61 @@ type Stats interface {
 const (
 	DefaultSampleSize = 1000
 	Latency           = "Latency"
-	TaskWait          = "TaskWait"
+	ScaleUp           = "ScaleUp"
+	ScaleDown         = "ScaleDown"
+
+	// TaskWait is not recorded, the time tasks wait in the queue is recorded
+	// under Latency.
+	//
+	// Deprecated: Use Latency instead.
+	TaskWait = "TaskWait"
 )
 
+// Drop records a dropped task if the publisher implements DropPublisher.
+func Drop(p Publisher, name string) {
+	if dp, ok := p.(DropPublisher); ok {
+		dp.Drop(name)
+	}
+}
+
+// Retry records a retry if the publisher implements RetryPublisher.
+func Retry(p Publisher, name string) {
+	if rp, ok := p.(RetryPublisher); ok {
+		rp.Retry(name)
+	}
+}
+
+// Collapse records a collapsed task if the publisher implements
+// CollapsePublisher.
+func Collapse(p Publisher, name string) {
+	if cp, ok := p.(CollapsePublisher); ok {
+		cp.Collapse(name)
+	}
+}
+
+// Timeout records a task timeout if the publisher implements
+// TimeoutPublisher.
+func Timeout(p Publisher, name string) {
+	if tp, ok := p.(TimeoutPublisher); ok {
+		tp.Timeout(name)
+	}
+}
+
+// Pause records a paused daemon if the publisher implements PausePublisher.
+func Pause(p Publisher, name string) {
+	if pp, ok := p.(PausePublisher); ok {
+		pp.Pause(name)
+	}
+}
+
+// Resume records a resumed daemon if the publisher implements
+// PausePublisher.
+func Resume(p Publisher, name string) {
+	if pp, ok := p.(PausePublisher); ok {
+		pp.Resume(name)
+	}
+}
+
 //
 // base
 //
@@ -54,14 +142,48 @@ func (b *base) Error(name string) {
 	b.metrics(name).errors.Inc(1)
 }
 
+func (b *base) Drop(name string) {
+	b.metrics(name).dropped.Inc(1)
+}
+
+func (b *base) Retry(name string) {
+	b.metrics(name).retried.Inc(1)
+}
+
+func (b *base) Collapse(name string) {
+	b.metrics(name).collapsed.Inc(1)
+}
+
+func (b *base) Timeout(name string) {
+	b.metrics(name).timedOut.Inc(1)
+}
+
+func (b *base) Pause(name string) {
+	b.metrics(name).paused.Update(1)
+}
+
+func (b *base) Resume(name string) {
+	b.metrics(name).paused.Update(0)
+}
+
 func (b *base) Fetch(name string) Stats {
 	return b.metrics(name)
 }
 
 func (b *base) Reset() {
+	b.Lock()
+	defer b.Unlock()
+	b.reset()
+}
+
+func (b *base) reset() {
 	for _, s := range b.stats {
 		s.time.Clear()
 		s.errors.Clear()
+		s.dropped.Clear()
+		s.retried.Clear()
+		s.collapsed.Clear()
+		s.timedOut.Clear()
 	}
 }
 
@@ -70,26 +192,29 @@ func (b *base) init() {
 }
 
 func (b *base) metrics(name string) *baseStats {
-	if _, ok := b.stats[name]; !ok {
-		b.Lock()
-		defer b.Unlock()
-
-		// Double checking being protected by mutex
-		if s, ok := b.stats[name]; ok {
-			return s
-		}
-
-		if b.sampleSize == 0 {
-			b.sampleSize = DefaultSampleSize
-		}
-		b.stats[name] = &baseStats{
-			name:   name,
-			time:   metrics.NewHistogram(metrics.NewUniformSample(b.sampleSize)),
-			errors: metrics.NewCounter(),
-		}
+	b.Lock()
+	defer b.Unlock()
+
+	if s, ok := b.stats[name]; ok {
+		return s
+	}
+
+	if b.sampleSize == 0 {
+		b.sampleSize = DefaultSampleSize
+	}
+	s := &baseStats{
+		name:      name,
+		time:      metrics.NewHistogram(metrics.NewUniformSample(b.sampleSize)),
+		errors:    metrics.NewCounter(),
+		dropped:   metrics.NewCounter(),
+		retried:   metrics.NewCounter(),
+		collapsed: metrics.NewCounter(),
+		timedOut:  metrics.NewCounter(),
+		paused:    metrics.NewGauge(),
 	}
+	b.stats[name] = s
 
-	return b.stats[name]
+	return s
 }
 
 //
@@ -97,9 +222,14 @@ func (b *base) metrics(name string) *baseStats {
 //
 
 type baseStats struct {
-	name   string
-	time   metrics.Histogram
-	errors metrics.Counter
+	name      string
+	time      metrics.Histogram
+	errors    metrics.Counter
+	dropped   metrics.Counter
+	retried   metrics.Counter
+	collapsed metrics.Counter
+	timedOut  metrics.Counter
+	paused    metrics.Gauge
 }
 
 func (s *baseStats) Processed() int64 {
@@ -110,6 +240,26 @@ func (s *baseStats) Errors() int64 {
 	return s.errors.Count()
 }
 
+func (s *baseStats) Dropped() int64 {
+	return s.dropped.Count()
+}
+
+func (s *baseStats) Retried() int64 {
+	return s.retried.Count()
+}
+
+func (s *baseStats) Collapsed() int64 {
+	return s.collapsed.Count()
+}
+
+func (s *baseStats) TimedOut() int64 {
+	return s.timedOut.Count()
+}
+
+func (s *baseStats) Paused() bool {
+	return s.paused.Value() == 1
+}
+
 func (s *baseStats) Min() int64 {
 	return s.time.Min()
 }
@@ -134,6 +284,11 @@ func (s *baseStats) String() string {
 	return fmt.Sprintf("%s statistics:\n"+
 		"Processed: %10d\n"+
 		"Errors:    %10d\n"+
+		"Dropped:   %10d\n"+
+		"Retried:   %10d\n"+
+		"Collapsed: %10d\n"+
+		"Timed out: %10d\n"+
+		"Paused:    %10t\n"+
 		"Min:       %10s\n"+
 		"Mean:      %10s\n"+
 		"95%%:       %10s\n"+
@@ -142,6 +297,11 @@ func (s *baseStats) String() string {
 		s.name,
 		s.time.Count(),
 		s.errors.Count(),
+		s.dropped.Count(),
+		s.retried.Count(),
+		s.collapsed.Count(),
+		s.timedOut.Count(),
+		s.paused.Value() == 1,
 		formatDuration(float64(s.time.Min())),
 		formatDuration(s.time.Mean()),
 		formatDuration(s.time.Percentile(0.95)),
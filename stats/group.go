@@ -25,3 +25,39 @@ func (g *Group) Error(name string) {
 		b.Error(name)
 	}
 }
+
+func (g *Group) Drop(name string) {
+	for _, b := range g.backends {
+		Drop(b, name)
+	}
+}
+
+func (g *Group) Retry(name string) {
+	for _, b := range g.backends {
+		Retry(b, name)
+	}
+}
+
+func (g *Group) Collapse(name string) {
+	for _, b := range g.backends {
+		Collapse(b, name)
+	}
+}
+
+func (g *Group) Timeout(name string) {
+	for _, b := range g.backends {
+		Timeout(b, name)
+	}
+}
+
+func (g *Group) Pause(name string) {
+	for _, b := range g.backends {
+		Pause(b, name)
+	}
+}
+
+func (g *Group) Resume(name string) {
+	for _, b := range g.backends {
+		Resume(b, name)
+	}
+}
@@ -45,13 +45,123 @@ func TestGroupError(t *testing.T) {
 	}
 }
 
+func TestGroupDrop(t *testing.T) {
+	g := NewGroup(newGroupItemMock(), newGroupItemMock())
+
+	g.Drop("")
+
+	for _, m := range g.backends {
+		select {
+		case <-m.(*groupItemMock).dropCalls:
+		default:
+			t.Error("Mock item didn't receive a Drop call")
+		}
+	}
+}
+
+func TestGroupRetry(t *testing.T) {
+	g := NewGroup(newGroupItemMock(), newGroupItemMock())
+
+	g.Retry("")
+
+	for _, m := range g.backends {
+		select {
+		case <-m.(*groupItemMock).retryCalls:
+		default:
+			t.Error("Mock item didn't receive a Retry call")
+		}
+	}
+}
+
+func TestGroupCollapse(t *testing.T) {
+	g := NewGroup(newGroupItemMock(), newGroupItemMock())
+
+	g.Collapse("")
+
+	for _, m := range g.backends {
+		select {
+		case <-m.(*groupItemMock).collapseCalls:
+		default:
+			t.Error("Mock item didn't receive a Collapse call")
+		}
+	}
+}
+
+func TestGroupTimeout(t *testing.T) {
+	g := NewGroup(newGroupItemMock(), newGroupItemMock())
+
+	g.Timeout("")
+
+	for _, m := range g.backends {
+		select {
+		case <-m.(*groupItemMock).timeoutCalls:
+		default:
+			t.Error("Mock item didn't receive a Timeout call")
+		}
+	}
+}
+
+func TestGroupPause(t *testing.T) {
+	g := NewGroup(newGroupItemMock(), newGroupItemMock())
+
+	g.Pause("")
+
+	for _, m := range g.backends {
+		select {
+		case <-m.(*groupItemMock).pauseCalls:
+		default:
+			t.Error("Mock item didn't receive a Pause call")
+		}
+	}
+}
+
+func TestGroupResume(t *testing.T) {
+	g := NewGroup(newGroupItemMock(), newGroupItemMock())
+
+	g.Resume("")
+
+	for _, m := range g.backends {
+		select {
+		case <-m.(*groupItemMock).resumeCalls:
+		default:
+			t.Error("Mock item didn't receive a Resume call")
+		}
+	}
+}
+
+func TestGroupOptional(t *testing.T) {
+	m := newGroupItemMock()
+	g := NewGroup(&Void{}, m)
+
+	// Backends that do not implement optional interfaces are skipped
+	g.Drop("")
+	g.Pause("")
+
+	select {
+	case <-m.dropCalls:
+	default:
+		t.Error("Mock item didn't receive a Drop call")
+	}
+	select {
+	case <-m.pauseCalls:
+	default:
+		t.Error("Mock item didn't receive a Pause call")
+	}
+}
+
 //
 // Mock
 //
 
 type groupItemMock struct {
-	addCalls   chan time.Duration
-	errorCalls chan struct{}
+	addCalls      chan time.Duration
+	errorCalls    chan struct{}
+	dropCalls     chan struct{}
+	retryCalls    chan struct{}
+	collapseCalls chan struct{}
+	timeoutCalls  chan struct{}
+	pauseCalls    chan struct{}
+	resumeCalls   chan struct{}
 }
 
 func (g *groupItemMock) Add(_ string, dur time.Duration) {
@@ -62,9 +172,39 @@ func (g *groupItemMock) Error(_ string) {
 	g.errorCalls <- struct{}{}
 }
 
+func (g *groupItemMock) Drop(_ string) {
+	g.dropCalls <- struct{}{}
+}
+
+func (g *groupItemMock) Retry(_ string) {
+	g.retryCalls <- struct{}{}
+}
+
+func (g *groupItemMock) Collapse(_ string) {
+	g.collapseCalls <- struct{}{}
+}
+
+func (g *groupItemMock) Timeout(_ string) {
+	g.timeoutCalls <- struct{}{}
+}
+
+func (g *groupItemMock) Pause(_ string) {
+	g.pauseCalls <- struct{}{}
+}
+
+func (g *groupItemMock) Resume(_ string) {
+	g.resumeCalls <- struct{}{}
+}
+
 func newGroupItemMock() *groupItemMock {
 	return &groupItemMock{
-		addCalls:   make(chan time.Duration, 1),
-		errorCalls: make(chan struct{}, 1),
+		addCalls:      make(chan time.Duration, 1),
+		errorCalls:    make(chan struct{}, 1),
+		dropCalls:     make(chan struct{}, 1),
+		retryCalls:    make(chan struct{}, 1),
+		collapseCalls: make(chan struct{}, 1),
+		timeoutCalls:  make(chan struct{}, 1),
+		pauseCalls:    make(chan struct{}, 1),
+		resumeCalls:   make(chan struct{}, 1),
 	}
 }
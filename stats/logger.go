@@ -29,11 +29,18 @@ func NewStdoutLogger(interval time.Duration) *Logger {
 }
 
 func (l *Logger) Print() {
+	l.Lock()
+	defer l.Unlock()
+
 	for _, s := range l.stats {
 		l.out.Write([]byte(s.String()))
 		l.out.Write([]byte{'\n'})
 		s.time.Clear()
 		s.errors.Clear()
+		s.dropped.Clear()
+		s.retried.Clear()
+		s.collapsed.Clear()
+		s.timedOut.Clear()
 	}
 }
 
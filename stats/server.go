@@ -60,7 +60,7 @@ func (s *Server) takeSnapshots() {
 			}
 			s.history[name] = append(s.history[name], makeServerStatsSnapshot(stat))
 		}
-		s.Reset()
+		s.reset()
 		s.Unlock()
 	}
 }
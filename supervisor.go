@@ -0,0 +1,174 @@
+package shezmu
+
+import (
+	"sync"
+	"time"
+)
+
+// Strategy defines which daemons are restarted when one of them crashes.
+type Strategy int
+
+const (
+	// OneForOne restarts only the system task that crashed according to the
+	// daemon restart policy.
+	OneForOne Strategy = iota
+	// OneForAll fully restarts all daemons of the group: each of them is shut
+	// down and then started up again.
+	OneForAll
+	// RestForOne fully restarts the crashed daemon and all daemons of the
+	// group that are started after it, respecting daemon dependencies and then
+	// the order in which daemons were added.
+	RestForOne
+)
+
+// Supervisor defines how a group of daemons recovers from crashes. A daemon
+// crashes when one of its system tasks panics or returns an error.
+type Supervisor struct {
+	// Strategy defines which daemons are restarted when one of them crashes.
+	Strategy Strategy
+	// RestartPolicy defines delays between group restarts and limits their
+	// intensity. When the restart budget is exhausted all daemons of the group
+	// are stopped and marked as failed. Not used by OneForOne strategy, which
+	// relies on daemon restart policies.
+	RestartPolicy RestartPolicy
+	// EscalatePanics makes panics in regular daemon tasks crash the daemon.
+	// Has no effect with OneForOne strategy.
+	EscalatePanics bool
+
+	daemons  []Daemon
+	restarts restartBudget
+
+	mu          sync.Mutex
+	attempt     int
+	restarting  bool
+	restartedAt time.Time
+}
+
+// AddGroup adds daemons as a group supervised by given supervisor. Supervisor
+// must not be shared between groups. An error is returned if one of the
+// daemons creates a dependency cycle, in which case the rest are not added.
+func (s *Shezmu) AddGroup(sup *Supervisor, daemons ...Daemon) error {
+	for _, d := range daemons {
+		d.base().supervisor = sup
+		if err := s.AddDaemon(d); err != nil {
+			d.base().supervisor = nil
+			return err
+		}
+
+		s.mu.Lock()
+		sup.daemons = append(sup.daemons, d)
+		s.mu.Unlock()
+	}
+
+	return nil
+}
+
+// handleCrash applies supervision strategy to a crashed daemon. System task
+// should be provided if the crash was caused by it.
+func (s *Shezmu) handleCrash(d Daemon, t *Task, err error) {
+	sup, strategy, policy, group := s.supervision(d)
+	if strategy == OneForOne {
+		if t != nil {
+			d.base().setState(StateCrashed, err)
+			s.restartSystemTask(t, err)
+		}
+		return
+	}
+	d.base().setState(StateCrashed, err)
+
+	affected := group
+	if strategy == RestForOne {
+		group = sortDaemons(group)
+		for i, gd := range group {
+			if gd == d {
+				affected = group[i:]
+				break
+			}
+		}
+	}
+
+	sup.mu.Lock()
+	if sup.restarting {
+		// Group is being restarted already
+		sup.mu.Unlock()
+		return
+	}
+	if !sup.restarts.allow(policy) {
+		sup.mu.Unlock()
+		d.base().log(LevelError, "Daemon crashed and its group exhausted the restart budget, stopping the group",
+			F("error", err), F("daemons", len(group)))
+		go func() {
+			// Daemons that were stopped with StopDaemon are not marked failed
+			running := runningDaemons(group)
+			s.stopDaemons(running)
+			for _, gd := range running {
+				gd.base().fail(err)
+			}
+		}()
+		return
+	}
+	if policy.MaxDelay > 0 && time.Now().Sub(sup.restartedAt) > policy.MaxDelay {
+		sup.attempt = 0
+	}
+	delay := policy.delay(sup.attempt)
+	sup.attempt++
+	sup.restarting = true
+	sup.mu.Unlock()
+
+	d.base().log(LevelWarn, "Daemon crashed, restarting its group",
+		F("error", err), F("daemons", len(affected)), F("delay", delay))
+	stopped := s.stopped()
+	// Restarting from a separate goroutine because stopping a daemon waits for
+	// its system tasks to finish, including the one that crashed
+	go func() {
+		// Daemons that were stopped with StopDaemon are not started again
+		running := runningDaemons(sortDaemons(affected))
+		s.stopInOrder(running)
+		select {
+		case <-stopped:
+			// All daemons were stopped while restart was pending
+		case <-time.After(delay):
+			for _, ad := range running {
+				s.setupDaemon(ad)
+			}
+		}
+
+		sup.mu.Lock()
+		sup.restarting = false
+		sup.restartedAt = time.Now()
+		sup.mu.Unlock()
+	}()
+}
+
+// supervision returns the supervisor of a daemon along with its strategy,
+// restart policy and the list of supervised daemons. Daemons that are not part
+// of a group are supervised by Shezmu itself.
+func (s *Shezmu) supervision(d Daemon) (*Supervisor, Strategy, RestartPolicy, []Daemon) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sup := d.base().supervisor; sup != nil {
+		return sup, sup.Strategy, sup.RestartPolicy, sup.daemons
+	}
+
+	var group []Daemon
+	for _, gd := range s.daemons {
+		if gd.base().supervisor == nil {
+			group = append(group, gd)
+		}
+	}
+
+	return s.root, s.Strategy, s.RestartPolicy, group
+}
+
+// runningDaemons returns daemons of the list that are running.
+func runningDaemons(daemons []Daemon) []Daemon {
+	var running []Daemon
+	for _, d := range daemons {
+		if d.base().isRunning() {
+			running = append(running, d)
+		}
+	}
+
+	return running
+}
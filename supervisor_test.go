@@ -0,0 +1,152 @@
+package shezmu
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type startupDaemon struct {
+	BaseDaemon
+	starts int64
+}
+
+func (d *startupDaemon) Startup() {
+	atomic.AddInt64(&d.starts, 1)
+}
+
+func (d *startupDaemon) crash() {
+	d.SystemProcessContext("crash", func(context.Context) error {
+		return errors.New("crash")
+	})
+}
+
+func newSupervisedDaemons(s *Shezmu, sup *Supervisor) []*startupDaemon {
+	daemons := []*startupDaemon{
+		{BaseDaemon: BaseDaemon{name: "first"}},
+		{BaseDaemon: BaseDaemon{name: "second"}},
+		{BaseDaemon: BaseDaemon{name: "third"}},
+	}
+	s.AddGroup(sup, daemons[0], daemons[1], daemons[2])
+
+	return daemons
+}
+
+// waitRestarted waits for the group restart to finish and all daemons to be
+// started the expected number of times.
+func waitRestarted(t *testing.T, sup *Supervisor, daemons []*startupDaemon, starts ...int64) {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		sup.mu.Lock()
+		done := !sup.restarting
+		sup.mu.Unlock()
+		for i, d := range daemons {
+			done = done && atomic.LoadInt64(&d.starts) == starts[i] && d.State() == StateRunning
+		}
+		if done {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	for i, d := range daemons {
+		t.Errorf("Expected %s to be started %d times, got %d", d, starts[i], atomic.LoadInt64(&d.starts))
+	}
+	t.FailNow()
+}
+
+func TestSupervisorOneForAll(t *testing.T) {
+	sup := &Supervisor{
+		Strategy:      OneForAll,
+		RestartPolicy: RestartPolicy{InitialDelay: time.Millisecond},
+	}
+	s := newTestShezmu()
+	daemons := newSupervisedDaemons(s, sup)
+	s.StartDaemons()
+	defer s.StopDaemons()
+	waitRestarted(t, sup, daemons, 1, 1, 1)
+
+	daemons[1].crash()
+	waitRestarted(t, sup, daemons, 2, 2, 2)
+}
+
+func TestSupervisorRestForOne(t *testing.T) {
+	sup := &Supervisor{
+		Strategy:      RestForOne,
+		RestartPolicy: RestartPolicy{InitialDelay: time.Millisecond},
+	}
+	s := newTestShezmu()
+	daemons := newSupervisedDaemons(s, sup)
+	s.StartDaemons()
+	defer s.StopDaemons()
+	waitRestarted(t, sup, daemons, 1, 1, 1)
+
+	daemons[1].crash()
+	waitRestarted(t, sup, daemons, 1, 2, 2)
+}
+
+func TestSupervisorSkipsStoppedDaemons(t *testing.T) {
+	sup := &Supervisor{
+		Strategy:      OneForAll,
+		RestartPolicy: RestartPolicy{InitialDelay: time.Millisecond},
+	}
+	s := newTestShezmu()
+	daemons := newSupervisedDaemons(s, sup)
+	s.StartDaemons()
+	defer s.StopDaemons()
+	waitRestarted(t, sup, daemons, 1, 1, 1)
+	s.StopDaemon("third")
+
+	daemons[0].crash()
+	waitRestarted(t, sup, daemons[:2], 2, 2)
+	if n := atomic.LoadInt64(&daemons[2].starts); n != 1 {
+		t.Errorf("Expected stopped daemon not to be restarted, started %d times", n)
+	}
+	if st := daemons[2].State(); st != StateStopped {
+		t.Errorf("Expected stopped daemon to stay stopped, got %s", st)
+	}
+}
+
+func TestSupervisorBudgetExhausted(t *testing.T) {
+	sup := &Supervisor{
+		Strategy: OneForAll,
+		RestartPolicy: RestartPolicy{
+			InitialDelay: time.Millisecond,
+			MaxRestarts:  1,
+			Window:       time.Minute,
+		},
+	}
+	s := newTestShezmu()
+	daemons := newSupervisedDaemons(s, sup)
+	failed := make(chan error, len(daemons))
+	for _, d := range daemons {
+		d.HandleFailure(func(err error) { failed <- err })
+	}
+	s.StartDaemons()
+	defer s.StopDaemons()
+	waitRestarted(t, sup, daemons, 1, 1, 1)
+
+	daemons[0].crash()
+	waitRestarted(t, sup, daemons, 2, 2, 2)
+	daemons[0].crash()
+	for range daemons {
+		select {
+		case err := <-failed:
+			if err == nil || err.Error() != "crash" {
+				t.Errorf("Expected daemon to fail with the crash error, got %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Expected all daemons of the group to fail")
+		}
+	}
+	for _, d := range daemons {
+		if st := d.State(); st != StateFailed || !d.Failed() {
+			t.Errorf("Expected %s to be failed, got %s", d, st)
+		}
+	}
+	if r := s.Health(); r.Live {
+		t.Error("Expected health report not to be live after the group failed")
+	}
+}
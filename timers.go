@@ -0,0 +1,269 @@
+package shezmu
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"github.com/localhots/shezmu/stats"
+)
+
+// DelayedPolicy defines what happens to pending delayed tasks when daemons are
+// stopped.
+type DelayedPolicy int
+
+const (
+	// DelayedDrop discards pending delayed tasks. Pending retries of failed
+	// tasks are passed to Shezmu.DeadLetters along with their last error.
+	DelayedDrop DelayedPolicy = iota
+	// DelayedRunEarly adds pending delayed tasks to the queue right away, so
+	// they are processed before daemons stop.
+	DelayedRunEarly
+)
+
+// DelayedTask is a handle of a task created by ProcessAfter or ProcessAt.
+type DelayedTask struct {
+	task   *Task
+	job    *Job
+	at     time.Time
+	index  int
+	timers *timers
+}
+
+// Cancel removes the task from the schedule. It returns false if the task was
+// already added to the queue or cancelled.
+func (dt *DelayedTask) Cancel() bool {
+	return dt.timers.remove(dt)
+}
+
+// fire adds a due task to the queue or starts a run of a periodic job.
+func (dt *DelayedTask) fire() {
+	if dt.job != nil {
+		dt.job.fire()
+	} else {
+		dt.task.daemon.base().enqueueDelayed(dt.task)
+	}
+}
+
+// timers keeps delayed tasks in a heap ordered by their due time, so that a
+// single goroutine could wait for all of them.
+type timers struct {
+	sync.Mutex
+	heap timerHeap
+	wake chan struct{}
+}
+
+func newTimers() *timers {
+	return &timers{wake: make(chan struct{}, 1)}
+}
+
+// add schedules a task and wakes up the timer loop if the task is due before
+// all the others.
+func (ts *timers) add(t *Task, at time.Time) *DelayedTask {
+	return ts.push(&DelayedTask{task: t, at: at, timers: ts})
+}
+
+// addJob schedules the next run of a periodic job.
+func (ts *timers) addJob(t *Task, j *Job, at time.Time) *DelayedTask {
+	return ts.push(&DelayedTask{task: t, job: j, at: at, timers: ts})
+}
+
+func (ts *timers) push(dt *DelayedTask) *DelayedTask {
+	ts.Lock()
+	heap.Push(&ts.heap, dt)
+	first := dt.index == 0
+	ts.Unlock()
+
+	if first {
+		select {
+		case ts.wake <- struct{}{}:
+		default:
+		}
+	}
+
+	return dt
+}
+
+func (ts *timers) remove(dt *DelayedTask) bool {
+	ts.Lock()
+	defer ts.Unlock()
+
+	if dt.index < 0 {
+		return false
+	}
+	heap.Remove(&ts.heap, dt.index)
+
+	return true
+}
+
+func (ts *timers) len() int {
+	ts.Lock()
+	defer ts.Unlock()
+
+	return len(ts.heap)
+}
+
+// due removes and returns the tasks that are due at the given time along with
+// the time the next task is due. Zero time is returned if there are no more
+// tasks.
+func (ts *timers) due(now time.Time) ([]*DelayedTask, time.Time) {
+	ts.Lock()
+	defer ts.Unlock()
+
+	var due []*DelayedTask
+	for len(ts.heap) > 0 && !ts.heap[0].at.After(now) {
+		due = append(due, heap.Pop(&ts.heap).(*DelayedTask))
+	}
+	if len(ts.heap) == 0 {
+		return due, time.Time{}
+	}
+
+	return due, ts.heap[0].at
+}
+
+// take removes and returns all pending tasks of given daemons in the order
+// they are due. All pending tasks are returned if no daemons are given. Next
+// runs of periodic jobs are removed but not returned, jobs are stopped along
+// with their daemons.
+func (ts *timers) take(daemons ...Daemon) []*Task {
+	ts.Lock()
+	defer ts.Unlock()
+
+	var pending []*DelayedTask
+	for _, dt := range ts.heap {
+		if len(daemons) == 0 || containsDaemon(daemons, dt.task.daemon) {
+			pending = append(pending, dt)
+		}
+	}
+	for _, dt := range pending {
+		heap.Remove(&ts.heap, dt.index)
+	}
+	tasks := make([]*Task, 0, len(pending))
+	for len(pending) > 0 {
+		// Pending tasks are not sorted, pick them one by one
+		first := 0
+		for i, dt := range pending {
+			if dt.at.Before(pending[first].at) {
+				first = i
+			}
+		}
+		if pending[first].job == nil {
+			tasks = append(tasks, pending[first].task)
+		}
+		pending = append(pending[:first], pending[first+1:]...)
+	}
+
+	return tasks
+}
+
+func containsDaemon(daemons []Daemon, d Daemon) bool {
+	for _, dd := range daemons {
+		if dd == d {
+			return true
+		}
+	}
+
+	return false
+}
+
+// runTimers adds delayed tasks to the queue when they are due. It returns when
+// daemons are stopped.
+func (s *Shezmu) runTimers() {
+	stopped := s.stopped()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-stopped:
+			return
+		case <-s.timers.wake:
+		case <-timer.C:
+		}
+
+		due, next := s.timers.due(time.Now())
+		for _, dt := range due {
+			// Waiting for the rate limit of one daemon should not delay
+			// tasks of others, tasks are enqueued in order otherwise
+			if dt.task.daemon.base().limit != nil {
+				go dt.fire()
+			} else {
+				dt.fire()
+			}
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if !next.IsZero() {
+			timer.Reset(next.Sub(time.Now()))
+		}
+	}
+}
+
+// flushTimers applies DelayedPolicy to pending delayed tasks of given daemons
+// or all daemons if none are given.
+func (s *Shezmu) flushTimers(daemons ...Daemon) {
+	tasks := s.timers.take(daemons...)
+	if len(tasks) == 0 {
+		return
+	}
+
+	switch s.DelayedPolicy {
+	case DelayedRunEarly:
+		s.Logger.Log(LevelInfo, "Running delayed tasks early", F("tasks", len(tasks)))
+		for _, t := range tasks {
+			t.daemon.base().enqueueDelayed(t)
+		}
+	default:
+		s.Logger.Log(LevelWarn, "Dropping delayed tasks", F("tasks", len(tasks)))
+		for _, t := range tasks {
+			stats.Drop(s.DaemonStats, t.daemon.String())
+			if t.attempt == 0 {
+				t.complete(ErrQueueClosed, nil)
+				continue
+			}
+			// Pending retry of a failed task is a permanent failure, the dead
+			// letter describes the last attempt that was made
+			last := *t
+			last.attempt--
+			s.deadLetter(&last, t.lastErr, nil)
+			t.complete(t.lastErr, nil)
+		}
+	}
+}
+
+//
+// Heap
+//
+
+type timerHeap []*DelayedTask
+
+func (h timerHeap) Len() int           { return len(h) }
+func (h timerHeap) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+
+func (h timerHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *timerHeap) Push(x interface{}) {
+	dt := x.(*DelayedTask)
+	dt.index = len(*h)
+	*h = append(*h, dt)
+}
+
+func (h *timerHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	dt := old[n-1]
+	old[n-1] = nil
+	dt.index = -1
+	*h = old[:n-1]
+
+	return dt
+}
@@ -0,0 +1,142 @@
+package shezmu
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTimersDue(t *testing.T) {
+	ts := newTimers()
+	now := time.Now()
+	t1, t2, t3 := &Task{}, &Task{}, &Task{}
+
+	ts.add(t3, now.Add(3*time.Second))
+	ts.add(t1, now.Add(time.Second))
+	ts.add(t2, now.Add(2*time.Second))
+
+	due, next := ts.due(now.Add(2 * time.Second))
+	if len(due) != 2 || due[0].task != t1 || due[1].task != t2 {
+		t.Errorf("Expected first two tasks to be due in order, got %v", due)
+	}
+	if !next.Equal(now.Add(3 * time.Second)) {
+		t.Errorf("Expected next task to be due in 3s, got %s", next.Sub(now))
+	}
+	if due, next = ts.due(now.Add(3 * time.Second)); len(due) != 1 || !next.IsZero() {
+		t.Errorf("Expected the last task to be due, got %v and next %s", due, next)
+	}
+}
+
+func TestTimersCancel(t *testing.T) {
+	ts := newTimers()
+	now := time.Now()
+	dt := ts.add(&Task{}, now)
+
+	if !dt.Cancel() {
+		t.Error("Expected pending task to be cancelled")
+	}
+	if dt.Cancel() {
+		t.Error("Expected second cancellation to fail")
+	}
+	if due, _ := ts.due(now); len(due) != 0 {
+		t.Errorf("Expected cancelled task not to be due, got %v", due)
+	}
+}
+
+func TestTimersTake(t *testing.T) {
+	ts := newTimers()
+	now := time.Now()
+	d1, d2 := &BaseDaemon{}, &BaseDaemon{}
+	t1, t2, t3 := &Task{daemon: d1}, &Task{daemon: d2}, &Task{daemon: d1}
+
+	ts.add(t3, now.Add(3*time.Second))
+	ts.add(t2, now.Add(2*time.Second))
+	ts.add(t1, now.Add(time.Second))
+
+	tasks := ts.take(d1)
+	if len(tasks) != 2 || tasks[0] != t1 || tasks[1] != t3 {
+		t.Errorf("Expected tasks of the daemon in due order, got %v", tasks)
+	}
+	if tasks = ts.take(); len(tasks) != 1 || tasks[0] != t2 {
+		t.Errorf("Expected remaining task to be taken, got %v", tasks)
+	}
+}
+
+func TestProcessAfter(t *testing.T) {
+	d := &testDaemon{BaseDaemon{name: "test"}}
+	s := newTestShezmu(d)
+	s.NumWorkers = 1
+	s.StartDaemons()
+	defer s.StopDaemons()
+	waitStarted(d)
+
+	var mu sync.Mutex
+	var order []int
+	done := make(chan struct{}, 2)
+	record := func(n int) ContextActor {
+		return func(context.Context) error {
+			mu.Lock()
+			order = append(order, n)
+			mu.Unlock()
+			done <- struct{}{}
+			return nil
+		}
+	}
+	// The only worker is busy until both tasks are due
+	block := make(chan struct{})
+	d.Process(func() { <-block })
+	start := time.Now()
+	d.ProcessAt(start.Add(20*time.Millisecond), record(1))
+	d.ProcessAfter(10*time.Millisecond, record(2))
+	time.Sleep(30 * time.Millisecond)
+	close(block)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Expected delayed tasks to be processed")
+		}
+	}
+	if dur := time.Now().Sub(start); dur < 20*time.Millisecond {
+		t.Errorf("Expected tasks to be processed after they are due, took %s", dur)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if exp := []int{2, 1}; !reflect.DeepEqual(order, exp) {
+		t.Errorf("Expected tasks to be processed in the order they are due %v, got %v", exp, order)
+	}
+}
+
+func TestDelayedPolicy(t *testing.T) {
+	for _, policy := range []DelayedPolicy{DelayedDrop, DelayedRunEarly} {
+		d := &testDaemon{BaseDaemon{name: "test"}}
+		s := newTestShezmu(d)
+		s.DelayedPolicy = policy
+		s.StartDaemons()
+		waitStarted(d)
+
+		ran := make(chan struct{}, 1)
+		dt := d.ProcessAfter(time.Hour, func(context.Context) error {
+			ran <- struct{}{}
+			return nil
+		})
+		s.StopDaemons()
+
+		if dt.Cancel() {
+			t.Errorf("Expected delayed task to be removed from the schedule with policy %d", policy)
+		}
+		select {
+		case <-ran:
+			if policy == DelayedDrop {
+				t.Error("Expected delayed task to be dropped")
+			}
+		default:
+			if policy == DelayedRunEarly {
+				t.Error("Expected delayed task to run before daemons stop")
+			}
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package shezmu
+
+import (
+	"context"
+	"time"
+
+	"github.com/localhots/shezmu/stats"
+)
+
+// CollapsePolicy defines which actor is kept when a unique task is collapsed
+// with a queued task that has the same key.
+type CollapsePolicy int
+
+const (
+	// CollapseKeepFirst keeps the actor of the queued task and drops the new
+	// one.
+	CollapseKeepFirst CollapsePolicy = iota
+	// CollapseKeepLast replaces the actor of the queued task with the new one,
+	// the task keeps its place in the queue.
+	CollapseKeepLast
+)
+
+// WithCollapse sets the collapse policy of a unique task. Default policy is
+// CollapseKeepFirst.
+func WithCollapse(p CollapsePolicy) TaskOption {
+	return func(t *Task) {
+		t.collapse = p
+	}
+}
+
+// WithDebounce delays a unique task until no tasks with the same key were
+// added for given duration.
+func WithDebounce(dur time.Duration) TaskOption {
+	return func(t *Task) {
+		t.debounce = dur
+	}
+}
+
+// uniqueTask is a unique task that was added but not started yet.
+type uniqueTask struct {
+	task  *Task
+	actor ContextActor
+	timer *DelayedTask
+}
+
+// ProcessUnique creates a task identified by a key and then adds it to
+// processing queue. If the daemon already has a task with the same key that
+// was not started yet, the new task is collapsed with it according to the
+// collapse policy. Collapsed tasks are reported to Shezmu.DaemonStats.
+func (d *BaseDaemon) ProcessUnique(key string, a ContextActor, opts ...TaskOption) {
+	t := d.newTask(a, opts)
+	if d.collapseUnique(key, t) {
+		stats.Collapse(d.shezmu.DaemonStats, d.String())
+		return
+	}
+
+	if t.debounce > 0 {
+		return
+	}
+
+	d.waitResumed()
+	d.waitRate()
+	t.createdAt = time.Now()
+	d.tryEnqueue(t)
+}
+
+// collapseUnique registers a new unique task. It returns true if the task was
+// collapsed with a queued one.
+func (d *BaseDaemon) collapseUnique(key string, t *Task) bool {
+	d.unique.Lock()
+	defer d.unique.Unlock()
+
+	if d.unique.tasks == nil {
+		d.unique.tasks = make(map[string]*uniqueTask)
+	}
+	if u, ok := d.unique.tasks[key]; ok {
+		if t.collapse == CollapseKeepLast {
+			u.actor = t.actor
+		}
+		// Debounced task waits for another quiet period unless it is already
+		// in the queue
+		if u.timer != nil && u.timer.Cancel() {
+			u.timer = d.shezmu.timers.add(u.task, time.Now().Add(u.task.debounce))
+		}
+		return true
+	}
+
+	u := &uniqueTask{task: t, actor: t.actor}
+	d.unique.tasks[key] = u
+	t.unique = key
+
+	// The actor is looked up when the task starts, so that it could be
+	// replaced while the task is queued. Retries of the task reuse it.
+	var actor ContextActor
+	t.actor = func(ctx context.Context) error {
+		if a := d.claimUnique(key, t); a != nil {
+			actor = a
+		}
+		return actor(ctx)
+	}
+	if t.debounce > 0 {
+		u.timer = d.shezmu.timers.add(t, time.Now().Add(t.debounce))
+	}
+
+	return false
+}
+
+// claimUnique removes a unique task that is about to start and returns its
+// actor. Tasks with the same key that are added afterwards are not collapsed
+// with it.
+func (d *BaseDaemon) claimUnique(key string, t *Task) ContextActor {
+	d.unique.Lock()
+	defer d.unique.Unlock()
+
+	u, ok := d.unique.tasks[key]
+	if !ok || u.task != t {
+		return nil
+	}
+	delete(d.unique.tasks, key)
+
+	return u.actor
+}
+
+// releaseUnique removes a unique task that was dropped without being started.
+func (d *BaseDaemon) releaseUnique(key string, t *Task) {
+	d.unique.Lock()
+	defer d.unique.Unlock()
+
+	if u, ok := d.unique.tasks[key]; ok && u.task == t {
+		delete(d.unique.tasks, key)
+	}
+}
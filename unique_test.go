@@ -0,0 +1,29 @@
+package shezmu
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCollapseUnique(t *testing.T) {
+	d := &BaseDaemon{}
+	var ran string
+	t1 := d.newTask(contextActor(func() { ran = "first" }), nil)
+	t2 := d.newTask(contextActor(func() { ran = "second" }), []TaskOption{WithCollapse(CollapseKeepLast)})
+
+	if d.collapseUnique("key", t1) {
+		t.Fatal("Expected the first task not to be collapsed")
+	}
+	if !d.collapseUnique("key", t2) {
+		t.Fatal("Expected the second task to be collapsed")
+	}
+	t1.actor(context.Background())
+	if ran != "second" {
+		t.Errorf("Expected the last actor to run, got %q", ran)
+	}
+
+	// Once started the task is no longer collapsible
+	if d.collapseUnique("key", d.newTask(contextActor(func() {}), nil)) {
+		t.Error("Expected a task added after start not to be collapsed")
+	}
+}
@@ -0,0 +1,352 @@
+package shezmu
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// TaskHandler is a function that processes a durable task payload.
+type TaskHandler func(ctx context.Context, payload []byte) error
+
+// WAL is a write-ahead log that makes tasks created with ProcessDurable
+// survive process crashes. Every durable task is written to the log before it
+// is added to the queue and marked as done once it is processed or fails
+// permanently. Tasks that were not done when the log was opened are replayed
+// by StartDaemons, which gives at-least-once execution semantics.
+type WAL struct {
+	mu        sync.Mutex
+	path      string
+	file      *os.File
+	enc       *json.Encoder
+	lastID    uint64
+	records   int
+	pending   map[uint64]walRecord
+	recovered []walRecord
+}
+
+type walRecord struct {
+	ID      uint64          `json:"id"`
+	Done    bool            `json:"done,omitempty"`
+	Daemon  string          `json:"daemon,omitempty"`
+	Type    string          `json:"type,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// walCompactThreshold is the minimum number of records in the log before it
+// is compacted.
+const walCompactThreshold = 1000
+
+// ErrNoWAL is returned by ProcessDurable when Shezmu has no write-ahead log.
+var ErrNoWAL = errors.New("write-ahead log is not configured")
+
+// OpenWAL opens a write-ahead log file, the file is created if it does not
+// exist. Pending tasks found in the log are replayed by StartDaemons.
+func OpenWAL(path string) (*WAL, error) {
+	w := &WAL{
+		path:    path,
+		pending: make(map[uint64]walRecord),
+	}
+	if err := w.load(); err != nil {
+		return nil, err
+	}
+	if err := w.compact(); err != nil {
+		return nil, err
+	}
+	for _, r := range w.pending {
+		w.recovered = append(w.recovered, r)
+	}
+	sort.Sort(walRecords(w.recovered))
+
+	return w, nil
+}
+
+// Close closes the log file.
+func (w *WAL) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.file.Close()
+}
+
+// Pending returns the number of durable tasks that are not done yet.
+func (w *WAL) Pending() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return len(w.pending)
+}
+
+// load reads the log and restores the list of pending tasks. A partially
+// written last record, which is the result of a crash, is ignored.
+func (w *WAL) load() error {
+	f, err := os.Open(w.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var r walRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			break
+		}
+		if r.ID > w.lastID {
+			w.lastID = r.ID
+		}
+		if r.Done {
+			delete(w.pending, r.ID)
+		} else {
+			w.pending[r.ID] = r
+		}
+	}
+
+	return scanner.Err()
+}
+
+// add writes a new task to the log and syncs it to disk.
+func (w *WAL) add(daemon, typ string, payload []byte) (uint64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.lastID++
+	r := walRecord{ID: w.lastID, Daemon: daemon, Type: typ, Payload: payload}
+	if err := w.enc.Encode(r); err != nil {
+		return 0, err
+	}
+	if err := w.file.Sync(); err != nil {
+		return 0, err
+	}
+	w.pending[r.ID] = r
+	w.records++
+
+	return r.ID, nil
+}
+
+// done marks a task as done. The record is not synced to disk, in the worst
+// case the task is replayed once again.
+func (w *WAL) done(id uint64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, ok := w.pending[id]; !ok {
+		return nil
+	}
+	delete(w.pending, id)
+	if err := w.enc.Encode(walRecord{ID: id, Done: true}); err != nil {
+		return err
+	}
+	w.records++
+
+	if w.records > walCompactThreshold && w.records > 2*len(w.pending) {
+		return w.compact()
+	}
+
+	return nil
+}
+
+// compact rewrites the log leaving only pending tasks in it. Must be called
+// with the mutex locked, unless the log is being opened.
+func (w *WAL) compact() error {
+	tmp := w.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	records := make([]walRecord, 0, len(w.pending))
+	for _, r := range w.pending {
+		records = append(records, r)
+	}
+	sort.Sort(walRecords(records))
+
+	enc := json.NewEncoder(f)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := os.Rename(tmp, w.path); err != nil {
+		f.Close()
+		return err
+	}
+	if w.file != nil {
+		w.file.Close()
+	}
+
+	w.file = f
+	w.enc = enc
+	w.records = len(records)
+
+	return nil
+}
+
+// takeRecovered returns tasks that were pending when the log was opened. They
+// are returned only once.
+func (w *WAL) takeRecovered() []walRecord {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	recovered := w.recovered
+	w.recovered = nil
+
+	return recovered
+}
+
+type walRecords []walRecord
+
+func (r walRecords) Len() int           { return len(r) }
+func (r walRecords) Less(i, j int) bool { return r[i].ID < r[j].ID }
+func (r walRecords) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+
+//
+// Durable tasks
+//
+
+// RegisterTaskType registers a handler for durable tasks of given type. Types
+// must be registered before daemon Startup function returns in order for
+// pending tasks to be replayed.
+func (d *BaseDaemon) RegisterTaskType(typ string, h TaskHandler) {
+	d.lifecycle.Lock()
+	defer d.lifecycle.Unlock()
+
+	if d.taskTypes == nil {
+		d.taskTypes = make(map[string]TaskHandler)
+	}
+	d.taskTypes[typ] = h
+}
+
+// ProcessDurable creates a task of a registered type, writes it to the
+// write-ahead log and then adds it to processing queue. Payload is encoded as
+// JSON and passed to the task handler. The task is replayed after a crash
+// unless it was processed or failed permanently. An error is returned if the
+// task could not be added to the queue, in which case it is removed from the
+// log and is not replayed.
+func (d *BaseDaemon) ProcessDurable(typ string, payload interface{}, opts ...TaskOption) error {
+	w := d.shezmu.WAL
+	if w == nil {
+		return ErrNoWAL
+	}
+	h, err := d.taskHandler(typ)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	id, err := w.add(d.String(), typ, data)
+	if err != nil {
+		return err
+	}
+
+	d.waitResumed()
+	d.waitRate()
+	t := d.newTask(durableActor(h, data), append(opts, withDurable(id, typ, data)))
+	if err := d.enqueue(t); err != nil {
+		d.shezmu.finishDurable(t)
+		return err
+	}
+
+	return nil
+}
+
+func (d *BaseDaemon) taskHandler(typ string) (TaskHandler, error) {
+	d.lifecycle.Lock()
+	defer d.lifecycle.Unlock()
+
+	h, ok := d.taskTypes[typ]
+	if !ok {
+		return nil, fmt.Errorf("Task type %q is not registered", typ)
+	}
+
+	return h, nil
+}
+
+func durableActor(h TaskHandler, payload []byte) ContextActor {
+	return func(ctx context.Context) error {
+		return h(ctx, payload)
+	}
+}
+
+func withDurable(id uint64, typ string, payload []byte) TaskOption {
+	return func(t *Task) {
+		t.durable = id
+		t.name = typ
+		t.payload = json.RawMessage(payload)
+	}
+}
+
+// replay adds pending tasks found in the write-ahead log to the queue. Tasks
+// of every daemon are added after the daemon has started.
+func (s *Shezmu) replay() {
+	if s.WAL == nil {
+		return
+	}
+	records := s.WAL.takeRecovered()
+	if len(records) == 0 {
+		return
+	}
+	s.Logger.Log(LevelInfo, "Replaying durable tasks", F("tasks", len(records)))
+
+	byDaemon := make(map[string][]walRecord)
+	for _, r := range records {
+		byDaemon[r.Daemon] = append(byDaemon[r.Daemon], r)
+	}
+	for name, records := range byDaemon {
+		d, err := s.lookup(name)
+		if err != nil {
+			s.Logger.Log(LevelError, "Failed to replay durable tasks",
+				F("daemon", name), F("tasks", len(records)), F("error", err))
+			continue
+		}
+		go s.replayDaemon(d, records)
+	}
+}
+
+func (s *Shezmu) replayDaemon(d Daemon, records []walRecord) {
+	base := d.base()
+	started, ok := base.startedChan()
+	if !ok {
+		return
+	}
+	select {
+	case <-started:
+	case <-base.ShutdownRequested():
+		return
+	}
+
+	for _, r := range records {
+		h, err := base.taskHandler(r.Type)
+		if err != nil {
+			base.log(LevelError, "Failed to replay durable task", F("task", r.Type), F("error", err))
+			continue
+		}
+		base.ProcessContext(durableActor(h, r.Payload), withDurable(r.ID, r.Type, r.Payload))
+	}
+}
+
+// finishDurable marks a durable task as done.
+func (s *Shezmu) finishDurable(t *Task) {
+	if t.durable == 0 || s.WAL == nil {
+		return
+	}
+	if err := s.WAL.done(t.durable); err != nil {
+		s.Logger.Log(LevelError, "Failed to mark durable task as done", t.fields(F("error", err))...)
+	}
+}
@@ -0,0 +1,117 @@
+package shezmu
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type durableDaemon struct {
+	BaseDaemon
+	payloads chan string
+}
+
+func (d *durableDaemon) Startup() {
+	d.RegisterTaskType("send", func(ctx context.Context, payload []byte) error {
+		d.payloads <- string(payload)
+		return nil
+	})
+}
+
+func TestWALRecovery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shezmu")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "tasks.wal")
+	w, err := OpenWAL(path)
+	if err != nil {
+		t.Fatalf("Failed to open WAL: %s", err.Error())
+	}
+	id1, _ := w.add("Invoices", "send", []byte(`{"id":1}`))
+	w.add("Invoices", "send", []byte(`{"id":2}`))
+	w.done(id1)
+	w.Close()
+
+	// Simulate a crash in the middle of writing a record
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	f.Write([]byte(`{"id":3,"daemon":"Inv`))
+	f.Close()
+
+	if w, err = OpenWAL(path); err != nil {
+		t.Fatalf("Failed to reopen WAL: %s", err.Error())
+	}
+	defer w.Close()
+
+	recovered := w.takeRecovered()
+	if len(recovered) != 1 || string(recovered[0].Payload) != `{"id":2}` {
+		t.Fatalf("Expected the second task to be recovered, got %v", recovered)
+	}
+	if recovered = w.takeRecovered(); len(recovered) != 0 {
+		t.Errorf("Expected recovered tasks to be returned once, got %d", len(recovered))
+	}
+	if id, _ := w.add("Invoices", "send", nil); id != 3 {
+		t.Errorf("Expected new task ID to be 3, got %d", id)
+	}
+	if n := w.Pending(); n != 2 {
+		t.Errorf("Expected 2 pending tasks, got %d", n)
+	}
+}
+
+func TestProcessDurable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shezmu")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "tasks.wal")
+
+	// A task left in the log by a previous process
+	w, err := OpenWAL(path)
+	if err != nil {
+		t.Fatalf("Failed to open WAL: %s", err.Error())
+	}
+	w.add("test", "send", []byte(`{"id":1}`))
+	w.Close()
+	if w, err = OpenWAL(path); err != nil {
+		t.Fatalf("Failed to reopen WAL: %s", err.Error())
+	}
+	defer w.Close()
+
+	d := &durableDaemon{BaseDaemon: BaseDaemon{name: "test"}, payloads: make(chan string, 1)}
+	s := newTestShezmu(d)
+	s.WAL = w
+	s.StartDaemons()
+
+	expect := func(payload string) {
+		select {
+		case p := <-d.payloads:
+			if p != payload {
+				t.Errorf("Expected payload %s, got %s", payload, p)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected task with payload %s to be processed", payload)
+		}
+	}
+	expect(`{"id":1}`)
+	if err := d.ProcessDurable("send", map[string]int{"id": 2}); err != nil {
+		t.Fatalf("Failed to process durable task: %s", err.Error())
+	}
+	expect(`{"id":2}`)
+	s.StopDaemons()
+	if n := w.Pending(); n != 0 {
+		t.Errorf("Expected processed tasks to be removed from the log, %d are pending", n)
+	}
+
+	if err := d.ProcessDurable("send", map[string]int{"id": 3}); err != ErrNotRunning {
+		t.Errorf("Expected ErrNotRunning once daemons are stopped, got %v", err)
+	}
+	if n := w.Pending(); n != 0 {
+		t.Errorf("Expected rejected task to be removed from the log, %d are pending", n)
+	}
+}
@@ -0,0 +1,171 @@
+package shezmu
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+	"time"
+
+	"github.com/localhots/shezmu/stats"
+)
+
+// DefaultWatchdogInterval is the default interval between checks for tasks
+// that run longer than their daemon allows.
+const DefaultWatchdogInterval = time.Second
+
+// inflightTask describes a task that is being processed.
+type inflightTask struct {
+	startedAt time.Time
+	pool      *pool
+	cancel    context.CancelFunc
+	// goroutine is the ID of the worker goroutine, it is only known for tasks
+	// of daemons with limited task duration
+	goroutine []byte
+	stuck     bool
+	replaced  bool
+}
+
+// trackTask registers a task as running. Pool and cancel function are only
+// set for regular tasks.
+func (s *Shezmu) trackTask(t *Task, p *pool, cancel context.CancelFunc) {
+	it := &inflightTask{
+		startedAt: time.Now(),
+		pool:      p,
+		cancel:    cancel,
+	}
+	if !t.system && t.daemon.base().timeout > 0 {
+		it.goroutine = goroutineID()
+	}
+
+	s.inflight.Lock()
+	s.inflight.tasks[t] = it
+	s.inflight.Unlock()
+}
+
+// untrackTask registers a task as finished. It returns true if the worker that
+// processed the task was replaced by the watchdog.
+func (s *Shezmu) untrackTask(t *Task) bool {
+	s.inflight.Lock()
+	it, ok := s.inflight.tasks[t]
+	delete(s.inflight.tasks, t)
+	s.inflight.Unlock()
+
+	if !ok {
+		return false
+	}
+	if it.stuck {
+		s.Logger.Log(LevelWarn, "Stuck task finished", t.fields(F("duration", time.Now().Sub(it.startedAt)))...)
+	}
+
+	return it.replaced
+}
+
+// watchdog periodically looks for tasks that run longer than their daemon
+// duration limit. It returns when daemons are stopped.
+func (s *Shezmu) watchdog() {
+	stopped := s.stopped()
+	interval := s.WatchdogInterval
+	if interval <= 0 {
+		interval = DefaultWatchdogInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopped:
+			return
+		case <-ticker.C:
+			s.checkStuckTasks()
+		}
+	}
+}
+
+// checkStuckTasks reports tasks that exceeded their duration limit for the
+// first time, cancels their context and optionally replaces their workers.
+func (s *Shezmu) checkStuckTasks() {
+	type stuckTask struct {
+		task *Task
+		*inflightTask
+	}
+
+	now := time.Now()
+	var stuck []stuckTask
+	s.inflight.Lock()
+	for t, it := range s.inflight.tasks {
+		if t.system || it.stuck {
+			continue
+		}
+		if limit := t.daemon.base().timeout; limit <= 0 || now.Sub(it.startedAt) <= limit {
+			continue
+		}
+		it.stuck = true
+		it.replaced = s.ReplaceStuckWorkers && it.pool != nil
+		stuck = append(stuck, stuckTask{t, it})
+	}
+	s.inflight.Unlock()
+	if len(stuck) == 0 {
+		return
+	}
+
+	stacks := allStacks()
+	for _, st := range stuck {
+		s.Logger.Log(LevelError, "Task is stuck", st.task.fields(
+			F("duration", now.Sub(st.startedAt)),
+			F("limit", st.task.daemon.base().timeout),
+			F("stack", goroutineStack(stacks, st.goroutine)))...)
+		stats.Timeout(s.DaemonStats, st.task.daemon.String())
+		st.cancel()
+		if st.replaced {
+			s.Logger.Log(LevelWarn, "Starting a worker to replace the stuck one", st.task.fields()...)
+			s.startWorkers(st.pool, 1)
+		}
+	}
+}
+
+// goroutineID returns the ID of the current goroutine as it appears in stack
+// traces.
+func goroutineID() []byte {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	// Stack trace starts with "goroutine 123 [running]:"
+	buf = bytes.TrimPrefix(buf, []byte("goroutine "))
+	if i := bytes.IndexByte(buf, ' '); i > 0 {
+		return buf[:i]
+	}
+
+	return nil
+}
+
+// allStacks returns stack traces of all goroutines.
+func allStacks() []byte {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// goroutineStack extracts the stack trace of a goroutine with given ID from
+// stack traces of all goroutines.
+func goroutineStack(stacks, id []byte) []byte {
+	if id == nil {
+		return nil
+	}
+
+	header := append(append([]byte("goroutine "), id...), ' ')
+	i := bytes.Index(stacks, header)
+	if i < 0 {
+		return nil
+	}
+	stack := stacks[i:]
+	// Stack traces of goroutines are separated with an empty line
+	if j := bytes.Index(stack, []byte("\n\n")); j >= 0 {
+		stack = stack[:j]
+	}
+
+	return stack
+}
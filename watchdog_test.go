@@ -0,0 +1,97 @@
+package shezmu
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/localhots/shezmu/stats"
+)
+
+func TestWatchdog(t *testing.T) {
+	d := &testDaemon{BaseDaemon{name: "test"}}
+	d.LimitDuration(20 * time.Millisecond)
+	s := newTestShezmu(d)
+	logger := &recordLogger{}
+	s.Logger = logger
+	st := stats.NewBasicStats()
+	s.DaemonStats = st
+	s.NumWorkers = 1
+	s.WatchdogInterval = 5 * time.Millisecond
+	s.ReplaceStuckWorkers = true
+	s.StartDaemons()
+	defer s.StopDaemons()
+	waitStarted(d)
+
+	cancelled := make(chan error, 1)
+	release := make(chan struct{})
+	d.ProcessContext(func(ctx context.Context) error {
+		<-ctx.Done()
+		cancelled <- ctx.Err()
+		// Task ignores cancellation and keeps its worker busy
+		<-release
+		return nil
+	})
+	select {
+	case err := <-cancelled:
+		if err == nil {
+			t.Error("Expected task context to be cancelled with an error")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected task context to be cancelled")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for st.Fetch("test").TimedOut() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := st.Fetch("test").TimedOut(); n != 1 {
+		t.Errorf("Expected 1 timeout to be recorded, got %d", n)
+	}
+	logger.Lock()
+	_, reported := logger.messages["Task is stuck"]
+	logger.Unlock()
+	if !reported {
+		t.Error("Expected stuck task to be reported")
+	}
+
+	// The only worker is stuck, the task is processed by its replacement
+	waitWorkers(t, s, 2)
+	if err := d.ProcessWait(func(context.Context) error { return nil }); err != nil {
+		t.Errorf("Expected task to be processed by the new worker, got %v", err)
+	}
+	close(release)
+	waitWorkers(t, s, 1)
+}
+
+func TestGoroutineStack(t *testing.T) {
+	id := goroutineID()
+	if len(id) == 0 {
+		t.Fatal("Expected goroutine ID to be found")
+	}
+
+	stack := goroutineStack(allStacks(), id)
+	if !bytes.HasPrefix(stack, []byte("goroutine "+string(id)+" ")) {
+		t.Fatalf("Unexpected stack header: %q", stack)
+	}
+	if !bytes.Contains(stack, []byte("TestGoroutineStack")) {
+		t.Errorf("Expected stack to contain test function, got:\n%s", stack)
+	}
+	if bytes.Contains(stack, []byte("\n\n")) {
+		t.Error("Expected stack of a single goroutine")
+	}
+}
+
+func TestGoroutineStackMissing(t *testing.T) {
+	stacks := []byte("goroutine 1 [running]:\nmain.main()\n\ngoroutine 12 [chan receive]:\nmain.foo()")
+	if s := goroutineStack(stacks, []byte("2")); s != nil {
+		t.Errorf("Expected no stack, got %q", s)
+	}
+	if s := goroutineStack(stacks, []byte("12")); string(s) != "goroutine 12 [chan receive]:\nmain.foo()" {
+		t.Errorf("Unexpected stack: %q", s)
+	}
+	if s := goroutineStack(stacks, nil); s != nil {
+		t.Errorf("Expected no stack, got %q", s)
+	}
+}